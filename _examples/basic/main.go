@@ -44,39 +44,19 @@ func examplePerRoute(router *http.ServeMux) {
 func exampleRegisterGroups(router *http.ServeMux) {
 	// version 1.
 	usersAPIV1 := versioning.NewGroup(">= 1, < 2")
-	usersAPIV1.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-			return
-		}
-
+	usersAPIV1.HandleFunc("GET /api/users", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("v1 resource: /api/users handler"))
 	})
-	usersAPIV1.HandleFunc("/api/users/new", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-			return
-		}
-
+	usersAPIV1.HandleFunc("POST /api/users/new", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("v1 resource: /api/users/new post handler"))
 	})
 
 	// version 2.
 	usersAPIV2 := versioning.NewGroup(">= 2, < 3")
-	usersAPIV2.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-			return
-		}
-
+	usersAPIV2.HandleFunc("GET /api/users", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("v2 resource: /api/users handler"))
 	})
-	usersAPIV2.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-			return
-		}
-
+	usersAPIV2.HandleFunc("POST /api/users", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("v2 resource: /api/users post handler"))
 	})
 
@@ -0,0 +1,63 @@
+package versioning
+
+import "github.com/hashicorp/go-version"
+
+// Version is a parsed version, the result of a `Comparer`'s `ParseVersion`.
+type Version interface {
+	// String returns the version sent to the client through the "X-API-Version" header.
+	String() string
+}
+
+// Checker is a parsed version constraint, the result of a `Comparer`'s `ParseConstraint`.
+type Checker interface {
+	// Check reports whether the "v" satisfies the constraint.
+	Check(v Version) bool
+}
+
+// Comparer parses the requested versions and the keys of a `Map`,
+// so APIs which are not versioned by semver, e.g. by date ("2023-10-01") or by plain integers,
+// can still use the matcher. See the `VersionComparer` matcher option and the `DefaultComparer`.
+type Comparer interface {
+	// ParseVersion parses a requested version, e.g. "2.1".
+	ParseVersion(v string) (Version, error)
+	// ParseConstraint parses a key of a `Map`, e.g. ">= 2, < 3".
+	ParseConstraint(constraint string) (Checker, error)
+}
+
+// Semver is the default `Comparer`, it compares semantic versions
+// through the go-version package, e.g. "2.1.0" satisfies ">= 2, < 3".
+//
+// The `Latest` version, the `Validate` and the precedence of the overlapping keys of a `Map`
+// are supported by the semver versions only, the rest comparers match the keys in alphabetical order.
+var Semver Comparer = semverComparer{}
+
+// DefaultComparer is the `Comparer` used by `If`, `Match`, `Versions` and
+// by the matchers which do not set the `VersionComparer` option.
+var DefaultComparer = Semver
+
+type semverComparer struct{}
+
+func (semverComparer) ParseVersion(v string) (Version, error) {
+	return version.NewVersion(v)
+}
+
+func (semverComparer) ParseConstraint(constraint string) (Checker, error) {
+	constraints, err := version.NewConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	return semverConstraints(constraints), nil
+}
+
+// semverConstraints is the `Checker` of the `Semver` comparer.
+type semverConstraints version.Constraints
+
+func (cs semverConstraints) Check(v Version) bool {
+	ver, ok := v.(*version.Version)
+	if !ok {
+		return false
+	}
+
+	return version.Constraints(cs).Check(ver)
+}
@@ -0,0 +1,86 @@
+package versioning_test
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kataras/versioning"
+)
+
+// intComparer compares plain integer versions, the constraints are "N" or ">= N".
+type intComparer struct{}
+
+type intVersion int
+
+func (v intVersion) String() string { return strconv.Itoa(int(v)) }
+
+type intChecker struct {
+	atLeast bool
+	v       intVersion
+}
+
+func (c intChecker) Check(v versioning.Version) bool {
+	n, ok := v.(intVersion)
+	if !ok {
+		return false
+	}
+
+	if c.atLeast {
+		return n >= c.v
+	}
+
+	return n == c.v
+}
+
+func (intComparer) ParseVersion(v string) (versioning.Version, error) {
+	n, err := strconv.Atoi(v)
+	return intVersion(n), err
+}
+
+func (intComparer) ParseConstraint(constraint string) (versioning.Checker, error) {
+	s := strings.TrimPrefix(constraint, ">=")
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	return intChecker{atLeast: s != constraint, v: intVersion(n)}, err
+}
+
+func TestNewMatcherVersionComparer(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1":    sendHandler(v10Response),
+		">= 2": sendHandler(v2Response),
+	}, versioning.VersionComparer(intComparer{}))
+
+	expectVersion(t, matcher, "1").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "1").
+		bodyEq(v10Response)
+	expectVersion(t, matcher, "v3").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "3").
+		bodyEq(v2Response)
+	expectVersion(t, matcher, "1.0").
+		statusCode(http.StatusNotImplemented)
+	expectVersion(t, matcher, versioning.Latest).
+		statusCode(http.StatusNotImplemented)
+
+	if _, err := versioning.NewMatcherErr(versioning.Map{"1.0": sendHandler(v10Response)}, versioning.VersionComparer(intComparer{})); err == nil {
+		t.Fatalf("expected an invalid version constraint error")
+	}
+}
+
+func TestDefaultComparer(t *testing.T) {
+	defer func(comparer versioning.Comparer) { versioning.DefaultComparer = comparer }(versioning.DefaultComparer)
+
+	if !versioning.If("1.0", ">= 1") {
+		t.Fatalf("expected semver versions to be compared by default")
+	}
+
+	versioning.DefaultComparer = intComparer{}
+	if !versioning.If("3", ">= 2") {
+		t.Fatalf("expected the integer version to match")
+	}
+	if versioning.If("1.0", ">= 1") {
+		t.Fatalf("expected an invalid integer version to not match")
+	}
+}
@@ -0,0 +1,554 @@
+package versioning
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// constraintOperators are the operators of a single version constraint,
+// longest first so "~>" and ">=" are not read as "~" and ">".
+var constraintOperators = []string{">=", "<=", "!=", "~>", ">", "<", "="}
+
+// splitConstraint returns the operator and the version of a single constraint, e.g. ">= 2.0" results to ">=" and "2.0".
+// An exact version like "2.0" has an empty operator.
+func splitConstraint(c *version.Constraint) (op string, ver *version.Version) {
+	s := strings.TrimSpace(c.String())
+	for _, operator := range constraintOperators {
+		if strings.HasPrefix(s, operator) {
+			op = operator
+			s = strings.TrimSpace(s[len(operator):])
+			break
+		}
+	}
+
+	ver, err := version.NewVersion(s)
+	if err != nil { // it's already parsed by the go-version package, so it should never happen.
+		return op, nil
+	}
+
+	return op, ver
+}
+
+// upperBound returns the (inclusive or exclusive) maximum version that the constraints accept,
+// e.g. "3.0" for ">= 2, < 3". A nil result means that the constraints have no upper limit, e.g. ">= 2".
+func upperBound(constraints version.Constraints) *version.Version {
+	var upper *version.Version
+
+	for _, c := range constraints {
+		op, ver := splitConstraint(c)
+		if ver == nil {
+			continue
+		}
+
+		switch op {
+		case "", "=", "<", "<=":
+		case "~>":
+			// "~> 1.2" means ">= 1.2, < 2.0" and "~> 1.2.3" means ">= 1.2.3, < 1.3.0",
+			// a single segment ("~> 1") has no upper limit.
+			segments := strings.Count(strings.TrimSpace(c.String())[len(op):], ".") + 1
+			if segments < 2 {
+				continue
+			}
+
+			next := ver.Segments()[:segments-1]
+			next[len(next)-1]++
+			ver = newVersionFromSegments(next)
+		default:
+			continue
+		}
+
+		if upper == nil || ver.LessThan(upper) {
+			upper = ver
+		}
+	}
+
+	return upper
+}
+
+// representative returns the highest version mentioned by the constraints which the constraints accept,
+// e.g. "2.0.0" for ">= 2, < 3". For an exclusive lower limit the next patch is used instead, e.g. "2.0.1" for "> 2".
+// It returns nil if there is no such a version, e.g. "< 3".
+func representative(constraints version.Constraints) *version.Version {
+	var result *version.Version
+
+	for _, c := range constraints {
+		op, candidate := splitConstraint(c)
+		if candidate == nil {
+			continue
+		}
+
+		if op == ">" {
+			segments := candidate.Segments()
+			segments[len(segments)-1]++
+			candidate = newVersionFromSegments(segments)
+		}
+
+		if constraints.Check(candidate) && (result == nil || candidate.GreaterThan(result)) {
+			result = candidate
+		}
+	}
+
+	return result
+}
+
+// compareConstraints compares two constraints by their upper limit,
+// a constraint without an upper limit is greater than any other one.
+// On equal upper limits their representative versions are compared instead.
+func compareConstraints(a, b version.Constraints) int {
+	aUpper, bUpper := upperBound(a), upperBound(b)
+	switch {
+	case aUpper == nil && bUpper != nil:
+		return 1
+	case aUpper != nil && bUpper == nil:
+		return -1
+	case aUpper != nil && bUpper != nil:
+		if cmp := aUpper.Compare(bUpper); cmp != 0 {
+			return cmp
+		}
+	}
+
+	aRep, bRep := representative(a), representative(b)
+	switch {
+	case aRep == nil && bRep == nil:
+		return 0
+	case aRep == nil:
+		return -1
+	case bRep == nil:
+		return 1
+	default:
+		return aRep.Compare(bRep)
+	}
+}
+
+// latestConstraint returns the constraints handler of the greatest version,
+// on equality the one with the higher precedence (see `Map`).
+// The constraints which are not semver ones are skipped.
+func latestConstraint(constraintsHandlers []*constraintsHandler) *constraintsHandler {
+	var latest *constraintsHandler
+	for _, ch := range constraintsHandlers {
+		if ch.constraints == nil {
+			continue
+		}
+
+		if latest == nil || compareConstraints(ch.constraints, latest.constraints) > 0 {
+			latest = ch
+		}
+	}
+
+	return latest
+}
+
+// isVersionRange reports whether the requested "v" is a range of versions, e.g. ">= 1, < 2" or ">=1 <2",
+// instead of a version or a list of versions, e.g. "2.0, 1.0;q=0.5".
+func isVersionRange(v string) bool {
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		for _, operator := range constraintOperators {
+			if strings.HasPrefix(part, operator) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// normalizeVersionRange converts a range of versions separated by spaces, e.g. ">=1 <2",
+// to the comma separated constraints of the go-version package, e.g. ">=1, <2".
+func normalizeVersionRange(v string) string {
+	var constraints []string
+	operator := ""
+	for _, field := range strings.Fields(strings.Replace(v, ",", " ", -1)) {
+		if isOperator(field) {
+			operator += field
+			continue
+		}
+
+		constraints = append(constraints, operator+field)
+		operator = ""
+	}
+
+	if operator != "" { // a trailing operator, let the go-version report it.
+		constraints = append(constraints, operator)
+	}
+
+	return strings.Join(constraints, ", ")
+}
+
+// trimExactOperator returns the version of a single exact constraint, e.g. "= 2.0" or "=2.0" results to "2.0",
+// so it's matched like the "2.0" instead of a range. The rest of the versions are returned as they are.
+func trimExactOperator(v string) string {
+	trimmed := strings.TrimSpace(v)
+	if strings.HasPrefix(trimmed, "=") && !strings.Contains(trimmed, ",") {
+		return strings.TrimSpace(trimmed[1:])
+	}
+
+	return v
+}
+
+// spaceSeparatedConstraint converts the comma separated constraints of a version key, e.g. ">= 2, < 3",
+// to a single range of versions separated by spaces, e.g. ">=2 <3", the form a client requests a range with.
+func spaceSeparatedConstraint(key string) string {
+	parts := strings.Split(key, ",")
+	for i, part := range parts {
+		parts[i] = strings.Join(strings.Fields(part), "")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// isOperator reports whether the "s" is a constraint operator, see `constraintOperators`.
+func isOperator(s string) bool {
+	for _, operator := range constraintOperators {
+		if s == operator {
+			return true
+		}
+	}
+
+	return false
+}
+
+// capVersion returns the "requested" version, list of versions or range of versions, limited to the "max" version,
+// see `CapTo`. An invalid "max" results to itself, so it's not matched instead of any version passing through.
+func capVersion(requested, max string) string {
+	maxVersion, err := version.NewVersion(normalizeVersion(max))
+	if err != nil {
+		return max
+	}
+
+	if isVersionRange(requested) {
+		return normalizeVersionRange(requested) + ", <= " + maxVersion.String()
+	}
+
+	candidates := parseVersionList(requested)
+	for i, candidate := range candidates {
+		if ver, err := version.NewVersion(normalizeVersion(candidate)); err == nil && ver.GreaterThan(maxVersion) {
+			candidates[i] = max
+		}
+	}
+
+	return strings.Join(candidates, ", ")
+}
+
+// negotiationCandidates returns the versions which the highest acceptable version is selected from,
+// see `NewMatcher`: the versions mentioned by the "requested" range
+// (the next patch for an exclusive lower limit) and the representative versions of the registered constraints.
+func negotiationCandidates(requested version.Constraints, constraintsHandlers []*constraintsHandler) []*version.Version {
+	var candidates []*version.Version
+
+	for _, c := range requested {
+		op, ver := splitConstraint(c)
+		if ver == nil {
+			continue
+		}
+
+		if op == ">" {
+			segments := ver.Segments()
+			segments[len(segments)-1]++
+			ver = newVersionFromSegments(segments)
+		}
+
+		candidates = append(candidates, ver)
+	}
+
+	for _, ch := range constraintsHandlers {
+		if ch.constraints == nil {
+			continue
+		}
+
+		if ver := representative(ch.constraints); ver != nil {
+			candidates = append(candidates, ver)
+		}
+	}
+
+	return candidates
+}
+
+// maxIndexedMajor is the highest major version of the `majorIndex`,
+// the constraints of higher majors, e.g. date-like "2023.10", are not indexed.
+const maxIndexedMajor = 1024
+
+// majorIndex indexes the constraints handlers by the major versions they can match,
+// so a requested version is checked against the constraints of its major only.
+type majorIndex struct {
+	majors    [][]*constraintsHandler // by major version, in precedence order.
+	unbounded []*constraintsHandler   // the ones without an upper limit, for the majors after the indexed ones.
+}
+
+// newMajorIndex returns the major index of the "constraintsHandlers", sorted by their precedence,
+// or nil if they cannot be indexed, i.e non-semver or date-like versions.
+func newMajorIndex(constraintsHandlers []*constraintsHandler) *majorIndex {
+	type majors struct {
+		lo, hi  int
+		bounded bool
+	}
+	ranges := make([]majors, len(constraintsHandlers))
+	maxMajor := 0
+
+	for i, ch := range constraintsHandlers {
+		if ch.constraints == nil {
+			return nil
+		}
+
+		lo, hi, bounded := majorRange(ch.constraints)
+		if lo > maxIndexedMajor || hi > maxIndexedMajor {
+			return nil
+		}
+
+		maxMajor = maxInt(maxMajor, maxInt(lo, hi))
+		ranges[i] = majors{lo, hi, bounded}
+	}
+
+	index := &majorIndex{majors: make([][]*constraintsHandler, maxMajor+1)}
+	for i, ch := range constraintsHandlers {
+		r := ranges[i]
+		if !r.bounded {
+			index.unbounded = append(index.unbounded, ch)
+			r.hi = maxMajor
+		}
+
+		for major := r.lo; major <= r.hi; major++ {
+			index.majors[major] = append(index.majors[major], ch)
+		}
+	}
+
+	return index
+}
+
+// candidates returns the constraints handlers which can match a version of the "major".
+func (index *majorIndex) candidates(major int) []*constraintsHandler {
+	if major < len(index.majors) {
+		return index.majors[major]
+	}
+
+	return index.unbounded
+}
+
+// majorRange returns the lowest and the highest major version that the constraints can match,
+// a false "bounded" means that there is no upper limit. The "hi" is lower than the "lo" when they match no version.
+func majorRange(constraints version.Constraints) (lo, hi int, bounded bool) {
+	setHi := func(major int) {
+		if !bounded || major < hi {
+			hi, bounded = major, true
+		}
+	}
+
+	for _, c := range constraints {
+		op, ver := splitConstraint(c)
+		if ver == nil {
+			continue
+		}
+
+		segments := ver.Segments()
+		major := segments[0]
+
+		switch op {
+		case "", "=":
+			lo = maxInt(lo, major)
+			setHi(major)
+		case ">", ">=":
+			lo = maxInt(lo, major)
+		case "~>":
+			lo = maxInt(lo, major)
+			// "~> 1.2" and "~> 1.2.3" stay on the same major, "~> 1" has no upper limit.
+			if strings.Contains(strings.TrimSpace(c.String())[len(op):], ".") {
+				setHi(major)
+			}
+		case "<=":
+			setHi(major)
+		case "<":
+			// "< 2" and "< 2.0.0" do not match any 2.x, but "< 2.1" and "< 2.0.0-beta" may.
+			if ver.Prerelease() == "" && segments[1] == 0 && segments[2] == 0 {
+				major--
+			}
+			setHi(major)
+		}
+	}
+
+	return lo, hi, bounded
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func newVersionFromSegments(segments []int) *version.Version {
+	parts := make([]string, len(segments))
+	for i, segment := range segments {
+		parts[i] = strconv.Itoa(segment)
+	}
+
+	return version.Must(version.NewVersion(strings.Join(parts, ".")))
+}
+
+// Validate reports an error if a key of the "versions" is not a valid version constraint
+// or if two of them accept the same version, i.e "1.0" and ">= 1, < 2".
+// Callers can use it, e.g. on a startup test, to make sure that every version is handled by a single handler.
+// The keys are parsed by the `DefaultComparer`, only the semver ones are checked for overlaps.
+//
+// See `Map` for the matching precedence of overlapping constraints.
+func Validate(versions Map) error {
+	constraintsHandlers, _, err := buildConstraints(versions, DefaultComparer)
+	if err != nil {
+		return err
+	}
+
+	semverHandlers := constraintsHandlers[:0]
+	for _, ch := range constraintsHandlers {
+		if ch.constraints != nil {
+			semverHandlers = append(semverHandlers, ch)
+		}
+	}
+	constraintsHandlers = semverHandlers
+
+	candidates := candidateVersions(constraintsHandlers)
+
+	for i, a := range constraintsHandlers {
+		for _, b := range constraintsHandlers[i+1:] {
+			for _, candidate := range candidates {
+				if a.constraints.Check(candidate) && b.constraints.Check(candidate) {
+					return fmt.Errorf("versioning: version constraints %q and %q overlap, e.g. on version %q", a.key, b.key, candidate.String())
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// HighestVersion returns the greatest version of the "versions", e.g. for a "/versions" endpoint.
+// Each key is represented by its highest mentioned version which it accepts (see `Latest`),
+// e.g. "2.5.0" for "2.5", "2.0.0" for ">= 2, < 3" and "2.0.1" for "> 2",
+// so an open-ended key like ">= 2" is represented by its lower limit, "2.0.0", as no greater version is named.
+// The `NotFound` key, the invalid keys and the keys without such a version (e.g. "< 3") are skipped.
+//
+// It returns an error if no key is left.
+func HighestVersion(versions Map) (string, error) {
+	var highest *version.Version
+
+	for key := range versions {
+		if key == NotFound {
+			continue
+		}
+
+		ch, err := newConstraintsHandler(Semver, key, nil)
+		if err != nil {
+			continue
+		}
+
+		if ver := representative(ch.constraints); ver != nil && (highest == nil || ver.GreaterThan(highest)) {
+			highest = ver
+		}
+	}
+
+	if highest == nil {
+		return "", fmt.Errorf("versioning: no valid versions")
+	}
+
+	return highest.String(), nil
+}
+
+// candidateVersions returns the versions which are enough to test if two constraints overlap:
+// the lowest version, each version mentioned by the constraints and their next patch.
+func candidateVersions(constraintsHandlers []*constraintsHandler) []*version.Version {
+	candidates := []*version.Version{newVersionFromSegments([]int{0, 0, 0})}
+
+	for _, ch := range constraintsHandlers {
+		for _, c := range ch.constraints {
+			_, ver := splitConstraint(c)
+			if ver == nil {
+				continue
+			}
+
+			segments := ver.Core().Segments()
+			segments[len(segments)-1]++
+
+			candidates = append(candidates, ver, newVersionFromSegments(segments))
+		}
+	}
+
+	return candidates
+}
+
+// wildcardConstraint returns the range of versions of a wildcard key, e.g. "2.x" or "2.*" results to ">= 2, < 3"
+// and "2.1.x" to ">= 2.1, < 2.2", and reports whether the "key" is a wildcard one.
+func wildcardConstraint(key string) (string, bool) {
+	key = normalizeVersion(key)
+
+	prefix := ""
+	for _, wildcard := range []string{".x", ".X", ".*"} {
+		if strings.HasSuffix(key, wildcard) {
+			prefix = strings.TrimSuffix(key, wildcard)
+			break
+		}
+	}
+
+	if prefix == "" {
+		return "", false
+	}
+
+	labels := strings.Split(prefix, ".")
+	if len(labels) > 2 {
+		return "", false
+	}
+
+	segments := make([]int, len(labels))
+	for i, label := range labels {
+		n, err := strconv.Atoi(label)
+		if err != nil || !isNumeric(label) {
+			return "", false
+		}
+
+		segments[i] = n
+	}
+
+	upper := make([]string, len(segments))
+	for i, n := range segments {
+		if i == len(segments)-1 {
+			n++
+		}
+
+		upper[i] = strconv.Itoa(n)
+	}
+
+	return fmt.Sprintf(">= %s, < %s", prefix, strings.Join(upper, ".")), true
+}
+
+// majorRangeHandler returns a copy of the "ch" which matches the whole major version of its key,
+// if the key is a bare major version, e.g. "1" or "v1" results to ">= 1, < 2". See the `MajorRanges`.
+// The rest of the keys, e.g. "1.0" or ">= 1", and the non-semver ones are kept as they are.
+func majorRangeHandler(ch *constraintsHandler) *constraintsHandler {
+	if ch.constraints == nil {
+		return ch
+	}
+
+	key := normalizeVersion(ch.key)
+	if !isNumeric(key) {
+		return ch
+	}
+
+	major, err := strconv.Atoi(key)
+	if err != nil { // too big.
+		return ch
+	}
+
+	constraints, err := version.NewConstraint(fmt.Sprintf(">= %d, < %d", major, major+1))
+	if err != nil {
+		return ch
+	}
+
+	return &constraintsHandler{
+		key:         ch.key,
+		checker:     semverConstraints(constraints),
+		constraints: constraints,
+		handler:     ch.handler,
+		info:        ch.info,
+	}
+}
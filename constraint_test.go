@@ -0,0 +1,99 @@
+package versioning_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kataras/versioning"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		versions []string
+		overlap  string // empty for no error.
+	}{
+		{[]string{"1.0", ">= 2, < 3", versioning.NotFound}, ""},
+		{[]string{"< 2", ">= 2, < 3", ">= 3"}, ""},
+		{[]string{"1.0", "1.1", "> 1.1, < 2"}, ""},
+		{[]string{"!= 1.0", "1.0"}, ""},
+		{[]string{"1.0", ">= 1, < 2"}, `version constraints "1.0" and ">= 1, < 2" overlap, e.g. on version "1.0.0"`},
+		{[]string{">= 2", ">= 2, < 3"}, `version constraints ">= 2, < 3" and ">= 2" overlap, e.g. on version "2.0.0"`},
+		{[]string{"1", "1.0.0"}, `version constraints "1" and "1.0.0" overlap, e.g. on version "1.0.0"`},
+		{[]string{"~> 1.2", ">= 1.9"}, `version constraints ">= 1.9" and "~> 1.2" overlap, e.g. on version "1.9.0"`},
+		{[]string{"> 1", "!= 3"}, `version constraints "!= 3" and "> 1" overlap, e.g. on version "3.0.1"`},
+		{[]string{"<= 2", "< 1"}, `version constraints "< 1" and "<= 2" overlap, e.g. on version "0.0.0"`},
+		{[]string{"1.x", "2.*"}, ""},
+		{[]string{"2.x", "2.5"}, `version constraints "2.5" and "2.x" overlap, e.g. on version "2.5.0"`},
+	}
+
+	for _, tt := range tests {
+		versions := make(versioning.Map)
+		for _, v := range tt.versions {
+			versions[v] = sendHandler(v)
+		}
+
+		err := versioning.Validate(versions)
+		if tt.overlap == "" {
+			if err != nil {
+				t.Fatalf("%q: expected no error but got: %v", tt.versions, err)
+			}
+
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("%q: expected an overlap error", tt.versions)
+		}
+
+		if got := err.Error(); !strings.Contains(got, tt.overlap) {
+			t.Fatalf("%q: expected error to contain: %s but got: %s", tt.versions, tt.overlap, got)
+		}
+	}
+
+	if err := versioning.Validate(versioning.Map{"invalid": sendHandler("")}); err == nil {
+		t.Fatalf("expected an error for an invalid version constraint")
+	}
+}
+
+func TestHighestVersion(t *testing.T) {
+	tests := []struct {
+		versions []string
+		expected string // empty for an error.
+	}{
+		{[]string{"1.0", ">= 2, < 3", versioning.NotFound}, "2.0.0"},
+		{[]string{"1.0", "2.5", ">= 2, < 3"}, "2.5.0"},
+		{[]string{"3.0", ">= 2"}, "3.0.0"},
+		{[]string{"1.0", ">= 2"}, "2.0.0"},
+		{[]string{"1.0", "> 2"}, "2.0.1"},
+		{[]string{"1.0", "< 3"}, "1.0.0"},
+		{[]string{"v1", "invalid", "1.2"}, "1.2.0"},
+		{[]string{"1.0", "2.x"}, "2.0.0"},
+		{[]string{"< 3"}, ""},
+		{[]string{"invalid", versioning.NotFound}, ""},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		versions := make(versioning.Map)
+		for _, v := range tt.versions {
+			versions[v] = sendHandler(v)
+		}
+
+		got, err := versioning.HighestVersion(versions)
+		if tt.expected == "" {
+			if err == nil {
+				t.Fatalf("%q: expected an error but got %q", tt.versions, got)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%q: expected no error but got: %v", tt.versions, err)
+		}
+
+		if got != tt.expected {
+			t.Fatalf("%q: expected highest version %q but got %q", tt.versions, tt.expected, got)
+		}
+	}
+}
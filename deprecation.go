@@ -2,6 +2,7 @@ package versioning
 
 import (
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -12,15 +13,40 @@ var HeaderTimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
 // - "X-API-Warn": options.WarnMessage
 // - "X-API-Deprecation-Date": time.Now().Format("Mon, 02 Jan 2006 15:04:05 GMT")
 // - "X-API-Deprecation-Info": options.DeprecationInfo
+//
+// If UseStandardHeaders is true then the RFC 8594 headers are sent too:
+// - "Deprecation": "true"
+// - "Sunset": options.DeprecationDate.UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")
+//
+// If UseStandardWarning is true then the RFC 7234 "Warning" header is sent too:
+// - "Warning": 299 - "options.WarnMessage" "options.DeprecationDate.UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")"
+//
+// If SuccessorLink is not empty then a "Link" header is added,
+// i.e Link: <https://api.example.com/v2/users>; rel="successor-version".
+//
+// If Scheduled is true then the DeprecationDate is the date the deprecation starts:
+// no deprecation headers are sent before that date and all of them are sent on and after it,
+// so a deprecation can be configured once, ahead of time.
+//
+// If BlockAfterSunset is true then the DeprecationDate is the sunset date of the version:
+// on and after that date the handler is no longer executed, the request is responded with the BlockStatus,
+// defaults to 410 Gone, along with the deprecation headers and the "Sunset" one.
 type DeprecationOptions struct {
-	WarnMessage     string
-	DeprecationDate time.Time
-	DeprecationInfo string
+	WarnMessage        string
+	DeprecationDate    time.Time
+	DeprecationInfo    string
+	UseStandardHeaders bool
+	UseStandardWarning bool
+	SuccessorLink      string
+	Scheduled          bool
+	BlockAfterSunset   bool
+	BlockStatus        int
 }
 
 // ShouldHandle reports whether the deprecation headers should be present or no.
 func (opts DeprecationOptions) ShouldHandle() bool {
-	return opts.WarnMessage != "" || !opts.DeprecationDate.IsZero() || opts.DeprecationInfo != ""
+	return opts.WarnMessage != "" || !opts.DeprecationDate.IsZero() || opts.DeprecationInfo != "" ||
+		opts.SuccessorLink != "" || opts.UseStandardHeaders || opts.UseStandardWarning
 }
 
 // DefaultDeprecationOptions are the default deprecation options,
@@ -29,6 +55,17 @@ var DefaultDeprecationOptions = DeprecationOptions{
 	WarnMessage: "WARNING! You are using a deprecated version of this API.",
 }
 
+// OnDeprecatedAccess, if not nil, is called on each request of a deprecated version, see `Deprecated`,
+// right after its deprecation headers are sent, e.g. to log the clients which still use that version.
+// It does not change the response. It should be set once, before serving any request.
+//
+// Example:
+//
+//	versioning.OnDeprecatedAccess = func(r *http.Request, options versioning.DeprecationOptions) {
+//		log.Printf("deprecated version %s used by %s (%s)", versioning.GetVersion(r), r.RemoteAddr, r.UserAgent())
+//	}
+var OnDeprecatedAccess func(r *http.Request, options DeprecationOptions)
+
 // Deprecated marks a specific handler as a deprecated.
 // Deprecated can be used to tell the clients that
 // a newer version of that specific resource is available instead.
@@ -37,17 +74,116 @@ func Deprecated(handler http.Handler, options DeprecationOptions) http.Handler {
 		options.WarnMessage = DefaultDeprecationOptions.WarnMessage
 	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("X-API-Warn", options.WarnMessage)
+	return &deprecatedHandler{
+		handler: handler,
+		options: options,
+	}
+}
+
+type deprecatedHandler struct {
+	handler http.Handler
+	options DeprecationOptions
+}
+
+func (d *deprecatedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if d.handle(w, r) {
+		d.handler.ServeHTTP(w, r)
+	}
+}
+
+// handle sends the deprecation headers and reports whether the request should be served,
+// otherwise the version is past its sunset date and the block response is already sent, see `BlockAfterSunset`.
+func (d *deprecatedHandler) handle(w http.ResponseWriter, r *http.Request) bool {
+	options := d.options
+	if options.Scheduled && time.Now().Before(options.DeprecationDate) {
+		varyVersion(w.Header(), r)
+		return true // not deprecated yet.
+	}
+
+	d.writeHeaders(w, r)
+	if onDeprecatedAccess := OnDeprecatedAccess; onDeprecatedAccess != nil {
+		onDeprecatedAccess(r, options)
+	}
+
+	if !options.BlockAfterSunset || options.DeprecationDate.IsZero() || time.Now().Before(options.DeprecationDate) {
+		return true
+	}
+
+	status := options.BlockStatus
+	if status == 0 {
+		status = http.StatusGone
+	}
+
+	w.Header().Set("Sunset", options.DeprecationDate.UTC().Format(HeaderTimeFormat))
+	http.Error(w, http.StatusText(status), status)
+	return false
+}
+
+// writeHeaders sends the deprecation headers.
+func (d *deprecatedHandler) writeHeaders(w http.ResponseWriter, r *http.Request) {
+	options := d.options
+
+	varyVersion(w.Header(), r)
+	w.Header().Set("X-API-Warn", options.WarnMessage)
+
+	if !options.DeprecationDate.IsZero() {
+		w.Header().Set("X-API-Deprecation-Date", options.DeprecationDate.Format(HeaderTimeFormat))
+	}
+
+	if options.DeprecationInfo != "" {
+		w.Header().Set("X-API-Deprecation-Info", options.DeprecationInfo)
+	}
+
+	if options.SuccessorLink != "" {
+		// add, instead of set, to keep any other links.
+		w.Header().Add("Link", "<"+options.SuccessorLink+`>; rel="successor-version"`)
+	}
+
+	if options.UseStandardHeaders {
+		w.Header().Set("Deprecation", "true")
 
 		if !options.DeprecationDate.IsZero() {
-			w.Header().Set("X-API-Deprecation-Date", options.DeprecationDate.Format(HeaderTimeFormat))
+			w.Header().Set("Sunset", options.DeprecationDate.UTC().Format(HeaderTimeFormat))
 		}
+	}
 
-		if options.DeprecationInfo != "" {
-			w.Header().Set("X-API-Deprecation-Info", options.DeprecationInfo)
+	if options.UseStandardWarning {
+		// 299 is the "Miscellaneous Persistent Warning" code and "-" stands for an unknown agent.
+		warning := "299 - " + quoteHeaderValue(options.WarnMessage)
+		if !options.DeprecationDate.IsZero() {
+			warning += " " + quoteHeaderValue(options.DeprecationDate.UTC().Format(HeaderTimeFormat))
 		}
 
-		handler.ServeHTTP(w, r)
-	})
+		w.Header().Add("Warning", warning)
+	}
+}
+
+// quoteHeaderValue returns the "s" as a quoted-string of a header value.
+func quoteHeaderValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// DeprecatedMap returns a copy of the "versions" which marks
+// the handlers of the "deprecated" versions as deprecated ones, see `Deprecated`.
+// The rest of the versions are kept as they are. Useful when a `NewMatcher` is used instead of a `Group`.
+//
+// Example:
+//
+//	versioning.NewMatcher(versioning.DeprecatedMap(versioning.Map{
+//		"1.0":       v1Handler,
+//		">= 2, < 3": v2Handler,
+//	}, []string{"1.0"}, versioning.DefaultDeprecationOptions))
+func DeprecatedMap(versions Map, deprecated []string, options DeprecationOptions) Map {
+	result := make(Map, len(versions))
+	for v, h := range versions {
+		result[v] = h
+	}
+
+	for _, v := range deprecated {
+		if h, ok := result[v]; ok && v != NotFound {
+			result[v] = Deprecated(h, options)
+		}
+	}
+
+	return result
 }
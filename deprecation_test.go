@@ -3,6 +3,7 @@ package versioning_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
 
@@ -31,5 +32,257 @@ func TestDeprecated(t *testing.T) {
 		statusCode(http.StatusOK).
 		headerEq("X-API-Warn", opts.WarnMessage).
 		headerEq("X-API-Deprecation-Date", expectedDeprecationDate).
+		headerEq("Vary", versioning.AcceptVersionHeaderKey).
 		bodyEq("1.0")
 }
+
+func TestDeprecatedStandardHeaders(t *testing.T) {
+	writeVesion := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versioning.GetVersion(r)))
+	})
+
+	opts := versioning.DeprecationOptions{
+		WarnMessage:        "deprecated, see <this link>",
+		DeprecationDate:    time.Date(2030, time.January, 2, 15, 4, 5, 0, time.FixedZone("EET", 2*60*60)),
+		UseStandardHeaders: true,
+	}
+
+	router := http.NewServeMux()
+	router.Handle("/", versioning.Deprecated(writeVesion, opts))
+	router.Handle("/legacy", versioning.Deprecated(writeVesion, versioning.DefaultDeprecationOptions))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	expect(t, http.MethodGet, srv.URL, withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", opts.WarnMessage).
+		headerEq("X-API-Deprecation-Date", opts.DeprecationDate.Format(versioning.HeaderTimeFormat)).
+		headerEq("Deprecation", "true").
+		headerEq("Sunset", "Wed, 02 Jan 2030 13:04:05 GMT").
+		bodyEq("1.0")
+
+	// standard headers are opt-in.
+	expect(t, http.MethodGet, srv.URL+"/legacy", withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("Deprecation", "").
+		headerEq("Sunset", "").
+		bodyEq("1.0")
+}
+
+func TestDeprecatedStandardWarning(t *testing.T) {
+	opts := versioning.DeprecationOptions{
+		WarnMessage:        `use the "v2" instead`,
+		DeprecationDate:    time.Date(2030, time.January, 2, 15, 4, 5, 0, time.FixedZone("EET", 2*60*60)),
+		UseStandardWarning: true,
+	}
+
+	expectVersion(t, versioning.Deprecated(sendHandler(v10Response), opts), "1.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", opts.WarnMessage).
+		headerEq("Warning", `299 - "use the \"v2\" instead" "Wed, 02 Jan 2030 13:04:05 GMT"`).
+		bodyEq(v10Response)
+
+	opts.DeprecationDate = time.Time{}
+	expectVersion(t, versioning.Deprecated(sendHandler(v10Response), opts), "1.0").
+		headerEq("Warning", `299 - "use the \"v2\" instead"`)
+
+	// the warning header is opt-in.
+	expectVersion(t, versioning.Deprecated(sendHandler(v10Response), versioning.DefaultDeprecationOptions), "1.0").
+		headerEq("Warning", "")
+}
+
+func TestDeprecatedScheduled(t *testing.T) {
+	deprecated := func(date time.Time) http.Handler {
+		return versioning.Deprecated(sendHandler(v10Response), versioning.DeprecationOptions{
+			DeprecationDate:    date,
+			UseStandardHeaders: true,
+			Scheduled:          true,
+		})
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name       string
+		date       time.Time
+		deprecated bool
+	}{
+		{"past", now.Add(-24 * time.Hour), true},
+		{"present", now, true},
+		{"future", now.Add(24 * time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := expectVersion(t, deprecated(tt.date), "1.0").
+				statusCode(http.StatusOK).
+				bodyEq(v10Response)
+
+			if tt.deprecated {
+				e.headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+					headerEq("X-API-Deprecation-Date", tt.date.Format(versioning.HeaderTimeFormat)).
+					headerEq("Deprecation", "true")
+			} else {
+				e.headerEq("X-API-Warn", "").
+					headerEq("X-API-Deprecation-Date", "").
+					headerEq("Deprecation", "").
+					headerEq("Sunset", "")
+			}
+		})
+	}
+
+	// not scheduled, the future date is the sunset one.
+	expectVersion(t, versioning.Deprecated(sendHandler(v10Response), versioning.DeprecationOptions{
+		DeprecationDate: now.Add(24 * time.Hour),
+	}), "1.0").
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage)
+}
+
+func TestDeprecatedBlockAfterSunset(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	blocked := func(date time.Time, status int) http.Handler {
+		return versioning.Deprecated(sendHandler(v10Response), versioning.DeprecationOptions{
+			DeprecationDate:  date,
+			BlockAfterSunset: true,
+			BlockStatus:      status,
+		})
+	}
+
+	// before the sunset the resource is still served.
+	expectVersion(t, blocked(future, 0), "1.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("Sunset", "").
+		bodyEq(v10Response)
+	// after the sunset.
+	expectVersion(t, blocked(past, 0), "1.0").
+		statusCode(http.StatusGone).
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("Sunset", past.UTC().Format(versioning.HeaderTimeFormat)).
+		bodyEq(http.StatusText(http.StatusGone) + "\n")
+	expectVersion(t, blocked(past, http.StatusNotFound), "1.0").
+		statusCode(http.StatusNotFound)
+	// no date.
+	expectVersion(t, blocked(time.Time{}, 0), "1.0").
+		statusCode(http.StatusOK)
+
+	// the block is opt-in.
+	expectVersion(t, versioning.Deprecated(sendHandler(v10Response), versioning.DeprecationOptions{DeprecationDate: past}), "1.0").
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+
+	// the middleware does not call the next handler.
+	middleware := versioning.Middleware(versioning.Map{
+		"1.0": blocked(past, 0),
+		"2.0": blocked(future, 0),
+	})(sendHandler("next"))
+	expectVersion(t, middleware, "1.0").
+		statusCode(http.StatusGone)
+	expectVersion(t, middleware, "2.0").
+		statusCode(http.StatusOK).
+		bodyEq("next")
+}
+
+func TestOnDeprecatedAccess(t *testing.T) {
+	defer func(fn func(*http.Request, versioning.DeprecationOptions)) { versioning.OnDeprecatedAccess = fn }(versioning.OnDeprecatedAccess)
+
+	var accesses []string
+	versioning.OnDeprecatedAccess = func(r *http.Request, options versioning.DeprecationOptions) {
+		accesses = append(accesses, versioning.GetVersion(r)+" "+r.UserAgent()+" "+options.WarnMessage)
+	}
+
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0": versioning.Deprecated(sendHandler(v10Response), versioning.DeprecationOptions{WarnMessage: "v1 is deprecated"}),
+		"1.5": versioning.Deprecated(sendHandler(v10Response), versioning.DeprecationOptions{
+			DeprecationDate: time.Now().Add(time.Hour),
+			Scheduled:       true,
+		}),
+		"2.0": sendHandler(v2Response),
+	})
+
+	serve := func(version string) *testie {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(versioning.AcceptVersionHeaderKey, version)
+		r.Header.Set("User-Agent", "client/1.0")
+		matcher.ServeHTTP(w, r)
+		return &testie{t: t, resp: w.Result()}
+	}
+
+	// the response is not changed.
+	serve("1.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", "v1 is deprecated").
+		bodyEq(v10Response)
+	serve("2.0").bodyEq(v2Response)
+	// not deprecated yet.
+	serve("1.5").bodyEq(v10Response)
+
+	if expected := []string{"1.0 client/1.0 v1 is deprecated"}; !reflect.DeepEqual(expected, accesses) {
+		t.Fatalf("expected deprecated accesses %v but got %v", expected, accesses)
+	}
+
+	// nil-safe.
+	versioning.OnDeprecatedAccess = nil
+	serve("1.0").statusCode(http.StatusOK)
+}
+
+func TestDeprecatedSuccessorLink(t *testing.T) {
+	withLink := func(link string, next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Link", link)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	opts := versioning.DeprecationOptions{
+		SuccessorLink: "https://api.example.com/v2/users",
+	}
+
+	router := http.NewServeMux()
+	router.Handle("/", withLink(`<https://api.example.com/users?page=2>; rel="next"`,
+		versioning.Deprecated(withLink(`<https://api.example.com/docs>; rel="help"`, sendHandler(v10Response)), opts)))
+	router.Handle("/no-link", versioning.Deprecated(sendHandler(v10Response), versioning.DefaultDeprecationOptions))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	expect(t, http.MethodGet, srv.URL).
+		statusCode(http.StatusOK).
+		headerValuesEq("Link",
+			`<https://api.example.com/users?page=2>; rel="next"`,
+			`<https://api.example.com/v2/users>; rel="successor-version"`,
+			`<https://api.example.com/docs>; rel="help"`).
+		bodyEq(v10Response)
+
+	expect(t, http.MethodGet, srv.URL+"/no-link").
+		statusCode(http.StatusOK).
+		headerValuesEq("Link").
+		bodyEq(v10Response)
+}
+
+func TestDeprecatedMap(t *testing.T) {
+	versions := versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	}
+
+	matcher := versioning.NewMatcher(versioning.DeprecatedMap(versions, []string{"1.0", "0.9"}, versioning.DefaultDeprecationOptions))
+
+	expectVersion(t, matcher, "1.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		bodyEq(v10Response)
+	expectVersion(t, matcher, "2.5").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", "").
+		bodyEq(v2Response)
+
+	// the original map is not modified.
+	expectVersion(t, versioning.NewMatcher(versions), "1.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", "").
+		bodyEq(v10Response)
+}
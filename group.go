@@ -1,14 +1,28 @@
 package versioning
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-version"
+)
 
 // Group is a group of version-based routes.
 // One version per one or more routes.
+// It's safe to register routes from multiple goroutines.
 type Group struct {
+	mu sync.Mutex
+
 	version string
-	routes  map[string]Map // key = path, value = map[version] = handler
+	routes  map[string]map[string]http.Handler // key = path, value = map[method] = handler
 
 	deprecation DeprecationOptions
+	// routeDeprecations are the deprecation options per path, they override the group's ones.
+	routeDeprecations map[string]DeprecationOptions
+	middleware        []func(http.Handler) http.Handler
 }
 
 // NewGroup returns a ptr to Group based on the given "version".
@@ -17,58 +31,194 @@ type Group struct {
 func NewGroup(version string) *Group {
 	return &Group{
 		version: version,
-		routes:  make(map[string]Map),
+		routes:  make(map[string]map[string]http.Handler),
 	}
 }
 
+// Version returns the version of this group, e.g. "1.0" or ">= 2, < 3".
+func (g *Group) Version() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.version
+}
+
+// SetVersion changes the version of this group and so the version of all its registered routes,
+// useful for code which assembles groups programmatically and adjusts them before `RegisterGroups`.
+// It returns itself.
+func (g *Group) SetVersion(version string) *Group {
+	g.mu.Lock()
+	g.version = version
+	g.mu.Unlock()
+
+	return g
+}
+
 // Deprecated marks this group and all its versioned routes
 // as deprecated versions of that endpoint.
 // It can be called in the end just before `RegisterGroups`
 // or first by `NewGroup(...).Deprecated(...)`. It returns itself.
 func (g *Group) Deprecated(options DeprecationOptions) *Group {
-	// if `Deprecated` is called in the end.
-	for _, versions := range g.routes {
-		versions[g.version] = Deprecated(versions[g.version], options)
+	// the handlers are wrapped on `RegisterGroups`,
+	// so it can be called before or after registering the versioned routes.
+	g.mu.Lock()
+	g.deprecation = options
+	g.mu.Unlock()
+
+	return g
+}
+
+// DeprecateRoute marks the versioned routes of the "path" of this group as deprecated,
+// its "options" override the group's ones (see `Deprecated`) for that path only,
+// e.g. so different paths can be sunset on different dates. The rest of the paths keep the group's options, if any.
+// A request method prefix, e.g. "GET /api/users", is ignored: all the methods of the path are deprecated.
+// Like `Deprecated`, it can be called before or after registering the versioned routes. It returns itself.
+//
+// Example:
+//
+//	usersAPIV1.DeprecateRoute("/api/users/export", versioning.DeprecationOptions{
+//		DeprecationDate:    time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC),
+//		UseStandardHeaders: true,
+//	})
+func (g *Group) DeprecateRoute(path string, options DeprecationOptions) *Group {
+	g.mu.Lock()
+	if g.routeDeprecations == nil {
+		g.routeDeprecations = make(map[string]DeprecationOptions)
 	}
+	_, path = splitPattern(path)
+	g.routeDeprecations[path] = options
+	g.mu.Unlock()
 
-	// store the options if called before registering any versioned routes.
-	g.deprecation = options
+	return g
+}
+
+// deprecationOf returns the deprecation options of the "path", see `DeprecateRoute`.
+func (g *Group) deprecationOf(path string) DeprecationOptions {
+	if options, ok := g.routeDeprecations[path]; ok {
+		return options
+	}
+
+	return g.deprecation
+}
+
+// Use registers one or more middleware which wrap every versioned route of this group,
+// e.g. authentication or logging ones. The first registered middleware is the outermost one
+// and all of them run before the deprecation headers (see `Deprecated`) are sent.
+// Like `Deprecated`, the routes are wrapped on `RegisterGroups`,
+// so it can be called before or after registering the versioned routes. It returns itself.
+func (g *Group) Use(middleware ...func(http.Handler) http.Handler) *Group {
+	g.mu.Lock()
+	g.middleware = append(g.middleware, middleware...)
+	g.mu.Unlock()
 
 	return g
 }
 
-func (g *Group) addVRoute(path string, handler http.Handler) {
-	if _, exists := g.routes[path]; !exists {
-		g.routes[path] = Map{g.version: handler}
+func (g *Group) addVRoute(pattern string, handler http.Handler) {
+	method, path := splitPattern(pattern)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	methods, exists := g.routes[path]
+	if !exists {
+		methods = make(map[string]http.Handler)
+		g.routes[path] = methods
 	}
+
+	// a later registration of the same path and method replaces the previous one.
+	methods[method] = handler
 }
 
 // Handle registers a versioned route to the group.
+// The "pattern" is the request path, optionally prefixed by a request method, e.g. "POST /api/users",
+// a request of a path without a handler for its method is responded with 405 Method Not Allowed.
+// Registering the same pattern again replaces its handler.
 // A call of `RegisterGroups` is necessary in order to register the actual routes
 // when the group is complete.
 //
 // See `RegisterGroups` for more.
-func (g *Group) Handle(path string, handler http.Handler) {
-	if g.deprecation.ShouldHandle() { // if `Deprecated` called first.
-		handler = Deprecated(handler, g.deprecation)
-	}
-
-	g.addVRoute(path, handler)
+func (g *Group) Handle(pattern string, handler http.Handler) {
+	g.addVRoute(pattern, handler)
 }
 
 // HandleFunc registers a versioned route to the group.
 // A call of `RegisterGroups` is necessary in order to register the actual routes
 // when the group is complete.
 //
-// See `RegisterGroups` for more.
-func (g *Group) HandleFunc(path string, handlerFn func(w http.ResponseWriter, r *http.Request)) {
-	var handler http.Handler = http.HandlerFunc(handlerFn)
+// See `Handle` and `RegisterGroups` for more.
+func (g *Group) HandleFunc(pattern string, handlerFn func(w http.ResponseWriter, r *http.Request)) {
+	g.addVRoute(pattern, http.HandlerFunc(handlerFn))
+}
+
+// handler returns the handler of the "methods" of a route of the "path".
+// If the route is deprecated and its `DeprecationInfo` is empty, it points to the "successor" version,
+// if it's newer than the group's one.
+func (g *Group) handler(path string, methods map[string]http.Handler, successor version.Constraints) http.Handler {
+	deprecation := g.deprecationOf(path)
+	if deprecation.ShouldHandle() && deprecation.DeprecationInfo == "" {
+		if ver := g.newerVersion(successor); ver != "" {
+			deprecation.DeprecationInfo = "use the " + ver + " version instead"
+		}
+	}
 
-	if g.deprecation.ShouldHandle() { // if `Deprecated` called first.
-		handler = Deprecated(handler, g.deprecation)
+	h := make(methodHandler, len(methods))
+	for method, handler := range methods {
+		if deprecation.ShouldHandle() {
+			handler = Deprecated(handler, deprecation)
+		}
+
+		for i := len(g.middleware) - 1; i >= 0; i-- {
+			handler = g.middleware[i](handler)
+		}
+
+		h[method] = handler
+	}
+
+	if handler, ok := h[""]; ok && len(h) == 1 { // no specific methods.
+		return handler
 	}
 
-	g.addVRoute(path, handler)
+	return h
+}
+
+// splitPattern splits a "[METHOD ]PATH" pattern, e.g. "GET /api/users" results to "GET" and "/api/users".
+func splitPattern(pattern string) (method, path string) {
+	pattern = strings.TrimSpace(pattern)
+	if idx := strings.IndexAny(pattern, " \t"); idx != -1 && !strings.Contains(pattern[:idx], "/") {
+		return pattern[:idx], strings.TrimLeft(pattern[idx:], " \t")
+	}
+
+	return "", pattern
+}
+
+// methodHandler is a map of request method to handler, an empty method matches any request method.
+type methodHandler map[string]http.Handler
+
+func (h methodHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := h[r.Method]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	if handler, ok := h[http.MethodGet]; ok && r.Method == http.MethodHead {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	if handler, ok := h[""]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	allow := make([]string, 0, len(h))
+	for method := range h {
+		allow = append(allow, method)
+	}
+	sort.Strings(allow)
+
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 }
 
 // StdMux is an interface which types like `net/http#ServeMux`
@@ -79,33 +229,237 @@ type StdMux interface{ Handle(string, http.Handler) }
 
 // RegisterGroups registers one or more groups to an `net/http#ServeMux` if not nil, and returns the routes.
 // Map's key is the request path from `Group#Handle` and value is the `http.Handler`.
+// It panics if two groups of the same version register the same path or a group's version is not a valid version constraint,
+// use the `RegisterGroupsErr` to handle these cases instead.
 // See `NewGroup` and `NotFoundHandler` too.
 func RegisterGroups(mux StdMux, notFoundHandler http.Handler, groups ...*Group) map[string]http.Handler {
+	routes, err := RegisterGroupsErr(mux, notFoundHandler, groups...)
+	if err != nil {
+		panic(err)
+	}
+
+	return routes
+}
+
+// RegisterGroupsErr same as `RegisterGroups` but it returns an error instead of panicking.
+// Nothing is registered to the "mux" on error.
+func RegisterGroupsErr(mux StdMux, notFoundHandler http.Handler, groups ...*Group) (map[string]http.Handler, error) {
+	return RegisterGroupsPrefixErr(mux, "", notFoundHandler, groups...)
+}
+
+// RegisterGroupsPrefix same as `RegisterGroups` but it mounts the routes under the "prefix",
+// e.g. the "/users" path of a group under the "/api" prefix is registered as "/api/users".
+// Map's key is the prefixed request path.
+// It panics on the same cases as `RegisterGroups`, use the `RegisterGroupsPrefixErr` to handle them instead.
+func RegisterGroupsPrefix(mux StdMux, prefix string, notFoundHandler http.Handler, groups ...*Group) map[string]http.Handler {
+	routes, err := RegisterGroupsPrefixErr(mux, prefix, notFoundHandler, groups...)
+	if err != nil {
+		panic(err)
+	}
+
+	return routes
+}
+
+// RegisterGroupsPrefixErr same as `RegisterGroupsPrefix` but it returns an error instead of panicking.
+// Nothing is registered to the "mux" on error.
+func RegisterGroupsPrefixErr(mux StdMux, prefix string, notFoundHandler http.Handler, groups ...*Group) (map[string]http.Handler, error) {
 	total := make(map[string]Map)
-	routes := make(map[string]http.Handler)
+	successors := successorVersions(groups)
+
+	for _, g := range groups {
+		g.mu.Lock()
+		for path, methods := range g.routes {
+			route := joinPath(prefix, path)
+			if _, exists := total[route]; !exists {
+				total[route] = make(Map)
+			}
+
+			if _, exists := total[route][g.version]; exists {
+				g.mu.Unlock()
+				return nil, fmt.Errorf("versioning: path %q of version %q is registered by more than one group", route, g.version)
+			}
+
+			total[route][g.version] = g.handler(path, methods, successors[path])
+		}
+		g.mu.Unlock()
+	}
+
+	return registerRoutes(mux, notFoundHandler, total)
+}
+
+// joinPath returns the "path" under the "prefix" with a single slash between them,
+// e.g. "/api" or "/api/" and "/users" or "users" result to "/api/users".
+// An empty prefix returns the "path" as it is and the "/" prefix returns it with a leading slash.
+func joinPath(prefix, path string) string {
+	if prefix == "" {
+		return path
+	}
+
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix == "" { // i.e "/".
+		return "/" + strings.TrimLeft(path, "/")
+	}
+
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	return prefix + "/" + strings.TrimLeft(path, "/")
+}
+
+// RegisterGroupPatterns same as `RegisterGroups` but it registers a route per request method and path,
+// e.g. "GET /api/users/{id}", instead of a route per path, so a Go 1.22+ `net/http#ServeMux`
+// matches the request methods and the path wildcards itself, i.e the `http.Request.PathValue` works as usual.
+// The routes of a group without a request method are registered by their path, e.g. "/api/users/{id}".
+// Map's key is the registered pattern and value is the `http.Handler`.
+//
+// It panics if two groups of the same version register the same pattern or a group's version is not a valid version constraint,
+// use the `RegisterGroupPatternsErr` to handle these cases instead.
+func RegisterGroupPatterns(mux StdMux, notFoundHandler http.Handler, groups ...*Group) map[string]http.Handler {
+	routes, err := RegisterGroupPatternsErr(mux, notFoundHandler, groups...)
+	if err != nil {
+		panic(err)
+	}
+
+	return routes
+}
+
+// RegisterGroupPatternsErr same as `RegisterGroupPatterns` but it returns an error instead of panicking.
+// Nothing is registered to the "mux" on error.
+func RegisterGroupPatternsErr(mux StdMux, notFoundHandler http.Handler, groups ...*Group) (map[string]http.Handler, error) {
+	total := make(map[string]Map)
+	successors := successorVersions(groups)
+
+	for _, g := range groups {
+		g.mu.Lock()
+		for path, methods := range g.routes {
+			for method, handler := range methods {
+				pattern := path
+				if method != "" {
+					pattern = method + " " + path
+				}
+
+				if _, exists := total[pattern]; !exists {
+					total[pattern] = make(Map)
+				}
+
+				if _, exists := total[pattern][g.version]; exists {
+					g.mu.Unlock()
+					return nil, fmt.Errorf("versioning: pattern %q of version %q is registered by more than one group", pattern, g.version)
+				}
+
+				total[pattern][g.version] = g.handler(path, map[string]http.Handler{"": handler}, successors[path])
+			}
+		}
+		g.mu.Unlock()
+	}
 
+	// the mux routes a request to the pattern of its method, if any, so the groups
+	// which registered the same path without a method should handle that pattern too,
+	// and the rest of the groups should respond to a request of a method they don't handle.
 	for _, g := range groups {
-		for path, versions := range g.routes {
-			if _, exists := total[path]; exists {
-				total[path][g.version] = versions[g.version]
-			} else {
-				total[path] = versions
+		g.mu.Lock()
+		for path, methods := range g.routes {
+			anyMethod, hasAnyMethod := methods[""]
+
+			for pattern, versions := range total {
+				if _, exists := versions[g.version]; exists {
+					continue
+				}
+
+				method, patternPath := splitPattern(pattern)
+				switch {
+				case patternPath != path:
+				case method == "":
+					versions[g.version] = g.handler(path, methods, successors[path])
+				case hasAnyMethod:
+					versions[g.version] = g.handler(path, map[string]http.Handler{"": anyMethod}, successors[path])
+				default: // responds with 405 Method Not Allowed.
+					versions[g.version] = g.handler(path, methods, successors[path])
+				}
 			}
 		}
+		g.mu.Unlock()
+	}
+
+	return registerRoutes(mux, notFoundHandler, total)
+}
+
+// newerVersion returns the "successor" as a version string, e.g. "2.0.0",
+// or empty if it's nil or not newer than the group's version.
+func (g *Group) newerVersion(successor version.Constraints) string {
+	if successor == nil {
+		return ""
 	}
 
-	for path, versions := range total {
+	ch, err := newConstraintsHandler(Semver, g.version, nil)
+	if err != nil || compareConstraints(successor, ch.constraints) <= 0 {
+		return ""
+	}
+
+	if ver := representative(successor); ver != nil {
+		return ver.String()
+	}
+
+	return successor.String()
+}
+
+// successorVersions returns the highest version of the groups which are not deprecated, per path,
+// so the deprecated groups can point their clients to it, see `RegisterGroups`.
+func successorVersions(groups []*Group) map[string]version.Constraints {
+	highest := make(map[string]version.Constraints)
+
+	for _, g := range groups {
+		g.mu.Lock()
+		ver := g.version
+		paths := make([]string, 0, len(g.routes))
+		for path := range g.routes {
+			if !g.deprecationOf(path).ShouldHandle() {
+				paths = append(paths, path)
+			}
+		}
+		g.mu.Unlock()
+
+		ch, err := newConstraintsHandler(Semver, ver, nil)
+		if err != nil { // an invalid version is reported by the matcher.
+			continue
+		}
+		constraints := ch.constraints
+
+		for _, path := range paths {
+			if current, ok := highest[path]; !ok || compareConstraints(constraints, current) > 0 {
+				highest[path] = constraints
+			}
+		}
+	}
+
+	return highest
+}
+
+// registerRoutes registers a matcher of the versions per route to the "mux", if not nil, and returns them.
+func registerRoutes(mux StdMux, notFoundHandler http.Handler, total map[string]Map) (map[string]http.Handler, error) {
+	matchers := make(map[string]*Matcher, len(total))
+	for route, versions := range total {
+		matcher, err := newMatcher(versions, nil)
+		if err != nil {
+			return nil, err
+		}
+
 		if notFoundHandler != nil {
-			versions[NotFound] = notFoundHandler
+			matcher.SetNotFound(notFoundHandler)
 		}
 
-		matcher := NewMatcher(versions)
+		matchers[route] = matcher
+	}
+
+	routes := make(map[string]http.Handler, len(matchers))
+	for route, matcher := range matchers {
 		if mux != nil {
-			mux.Handle(path, matcher)
+			mux.Handle(route, matcher)
 		}
 
-		routes[path] = matcher
+		routes[route] = matcher
 	}
 
-	return routes
+	return routes, nil
 }
@@ -0,0 +1,92 @@
+package versioning
+
+import (
+	"net/http"
+	"time"
+)
+
+// VersionInfo describes a registered version, i.e its release date and stability level,
+// the handlers of that version can read it through `GetVersionInfo`, e.g. to send an "X-API-Stability" header.
+type VersionInfo struct {
+	ReleaseDate time.Time
+	// Stability is the stability level of the version, e.g. "stable", "beta" or "experimental".
+	Stability string
+	// RateLimitTier is the rate limit tier of the version, e.g. "standard".
+	RateLimitTier string
+	// Metadata holds any other, application-specific, information.
+	Metadata map[string]interface{}
+}
+
+// VersionHandler is the handler of a version and its information, see `MapWithInfo`.
+type VersionHandler struct {
+	Handler http.Handler
+	Info    VersionInfo
+}
+
+// MapWithInfo is a map of version to handler and its information.
+// Its `Map` method returns the `Map` of the `NewMatcher` and `Middleware`.
+//
+// Example:
+//
+//	versioning.NewMatcher(versioning.MapWithInfo{
+//		"1.0":       {Handler: v1Handler, Info: versioning.VersionInfo{Stability: "stable"}},
+//		">= 2, < 3": {Handler: v2Handler, Info: versioning.VersionInfo{Stability: "beta"}},
+//	}.Map())
+type MapWithInfo map[string]VersionHandler
+
+// Map returns the `Map` of the versions, their handlers carry their information, see `WithInfo`.
+func (m MapWithInfo) Map() Map {
+	versions := make(Map, len(m))
+	for v, h := range m {
+		versions[v] = WithInfo(h.Handler, h.Info)
+	}
+
+	return versions
+}
+
+// WithInfo attaches the "info" to the "handler" of a `Map` entry,
+// the matcher makes it available to the handler through `GetVersionInfo`.
+// Outside of a matcher the "handler" is executed as it is.
+func WithInfo(handler http.Handler, info VersionInfo) http.Handler {
+	return &versionInfoHandler{
+		handler: handler,
+		info:    info,
+	}
+}
+
+type versionInfoHandler struct {
+	handler http.Handler
+	info    VersionInfo
+}
+
+func (h *versionInfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+// unwrapInfo returns the "handler" without its `WithInfo` wrapper and its information, if any.
+// The information of a deprecated handler (see `Deprecated` and `DeprecatedMap`) is reached too,
+// the deprecation wrapper is kept.
+func unwrapInfo(handler http.Handler) (http.Handler, *VersionInfo) {
+	switch h := handler.(type) {
+	case *versionInfoHandler:
+		return h.handler, &h.info
+	case *deprecatedHandler:
+		if inner, info := unwrapInfo(h.handler); info != nil {
+			return &deprecatedHandler{handler: inner, options: h.options}, info
+		}
+	}
+
+	return handler, nil
+}
+
+// GetVersionInfo returns the information of the matched version, see `MapWithInfo`.
+// It reports false if the request was not matched by a matcher or the matched version has no information.
+// The innermost matcher of nested matchers provides its own version information.
+func GetVersionInfo(r *http.Request) (VersionInfo, bool) {
+	ch, ok := r.Context().Value(matchedContextKey{}).(*constraintsHandler)
+	if !ok || ch.info == nil {
+		return VersionInfo{}, false
+	}
+
+	return *ch.info, true
+}
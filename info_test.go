@@ -0,0 +1,94 @@
+package versioning_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kataras/versioning"
+)
+
+func TestMapWithInfo(t *testing.T) {
+	writeStability := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, ok := versioning.GetVersionInfo(r)
+		if !ok {
+			w.Write([]byte("no info"))
+			return
+		}
+
+		w.Header().Set("X-API-Stability", info.Stability)
+		w.Write([]byte(info.RateLimitTier))
+	})
+
+	releaseDate := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	versions := versioning.MapWithInfo{
+		"1.0": {Handler: writeStability, Info: versioning.VersionInfo{
+			ReleaseDate:   releaseDate,
+			Stability:     "stable",
+			RateLimitTier: "standard",
+		}},
+		">= 2, < 3": {Handler: writeStability, Info: versioning.VersionInfo{Stability: "beta", RateLimitTier: "limited"}},
+		"3.0":       {Handler: writeStability},
+	}.Map()
+	// a plain handler of a `Map`.
+	versions["4.0"] = writeStability
+
+	matcher := versioning.NewMatcher(versions)
+
+	expectVersion(t, matcher, "1.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Stability", "stable").
+		bodyEq("standard")
+	expectVersion(t, matcher, "2.1").
+		headerEq("X-API-Stability", "beta").
+		bodyEq("limited")
+	// an empty info is still an info.
+	expectVersion(t, matcher, "3.0").
+		headerEq("X-API-Stability", "").
+		bodyEq("")
+	expectVersion(t, matcher, "4.0").
+		bodyEq("no info")
+
+	// the middleware passes the info to the next handler.
+	middleware := versioning.Middleware(versioning.MapWithInfo{
+		">= 2, < 3": {Info: versioning.VersionInfo{Stability: "beta"}},
+	}.Map())(writeStability)
+	expectVersion(t, middleware, "2.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Stability", "beta")
+
+	// the deprecated handlers keep their info.
+	deprecated := versioning.NewMatcher(versioning.MapWithInfo{
+		"1.0": {Handler: versioning.Deprecated(writeStability, versioning.DefaultDeprecationOptions), Info: versioning.VersionInfo{Stability: "deprecated"}},
+	}.Map())
+	expectVersion(t, deprecated, "1.0").
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("X-API-Stability", "deprecated")
+
+	// and the info of the deprecated ones too.
+	deprecated = versioning.NewMatcher(versioning.Map{
+		"1.0": versioning.Deprecated(versioning.WithInfo(writeStability, versioning.VersionInfo{Stability: "deprecated"}), versioning.DefaultDeprecationOptions),
+	})
+	expectVersion(t, deprecated, "1.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("X-API-Stability", "deprecated")
+
+	deprecated = versioning.NewMatcher(versioning.DeprecatedMap(versioning.MapWithInfo{
+		"1.0": {Handler: writeStability, Info: versioning.VersionInfo{Stability: "legacy"}},
+	}.Map(), []string{"1.0"}, versioning.DefaultDeprecationOptions))
+	expectVersion(t, deprecated, "1.0").
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("X-API-Stability", "legacy")
+
+	if _, ok := versioning.GetVersionInfo(httptest.NewRequest(http.MethodGet, "/", nil)); ok {
+		t.Fatalf("expected no version info outside of a matcher")
+	}
+
+	// outside of a matcher the handler is executed as it is.
+	w := httptest.NewRecorder()
+	versioning.WithInfo(writeStability, versioning.VersionInfo{Stability: "beta"}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	(&testie{t: t, resp: w.Result()}).
+		bodyEq("no info")
+}
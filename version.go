@@ -1,28 +1,60 @@
 package versioning
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-var (
-	// contextKey is the context key of the version.
-	contextKey interface{} = "api.version"
-	// NotFound is the key that can be used inside a `Map` or inside `context.WithValue(r.Context(), versioning.contextKey, versioning.NotFound)`
-	// to tell that a version wasn't found, therefore the not found handler should handle the request instead.
-	NotFound = contextKey.(string) + ".notfound"
+type (
+	// contextKey is the context key type of the version,
+	// a private type so it does not collide with the keys of other packages, e.g. an "api.version" string.
+	contextKey struct{}
+	// requestedContextKey is the context key type of the requested version, as it was extracted by the matcher.
+	requestedContextKey struct{}
+	// matchedContextKey is the context key type of the matched constraints handler, see `FallThrough`.
+	matchedContextKey struct{}
+	// supportedContextKey is the context key type of the registered versions of the matcher,
+	// it's set when no version matches.
+	supportedContextKey struct{}
 )
 
+// NotFound is the key that can be used inside a `Map` or inside `versioning.WithVersion(r.Context(), versioning.NotFound)`
+// to tell that a version wasn't found, therefore the not found handler should handle the request instead.
+var NotFound = "api.version.notfound"
+
+// Latest is the requested version that `NewMatcher` routes to the highest registered version,
+// i.e Accept-Version: "latest". The versions are compared by their upper limit,
+// a constraint without an upper limit (e.g. ">= 2") is considered the highest one.
+const Latest = "latest"
+
+// AcceptVersionHeaderKey is the header key of "Accept-Version".
+// It can be modified to read the version from a custom header instead, e.g. "X-Api-Version",
+// the "Accept" header is still used as a fallback. An empty value means "Accept-Version".
+var AcceptVersionHeaderKey = defaultAcceptVersionHeaderKey
+
 const (
-	// AcceptVersionHeaderKey is the header key of "Accept-Version".
-	AcceptVersionHeaderKey = "Accept-Version"
+	defaultAcceptVersionHeaderKey = "Accept-Version"
 	// AcceptHeaderKey is the header key of "Accept".
 	AcceptHeaderKey = "Accept"
 	// AcceptHeaderVersionValue is the Accept's header value search term the requested version.
 	AcceptHeaderVersionValue = "version"
 )
 
+// AcceptVendorPrefix is the prefix of the vendor media types of the "Accept" header
+// that contain the requested version, i.e "application/vnd.myapi.v2+json" results to "2".
+// It can be modified to a more specific one, e.g. "application/vnd.myapi.", an empty value disables it.
+var AcceptVendorPrefix = "application/vnd."
+
 var versionNotFoundText = []byte("version not found")
 
 // NotFoundHandler is the default version not found handler that
@@ -44,6 +76,276 @@ var NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Reque
 	w.Write(versionNotFoundText)
 })
 
+// NotFoundOptions describes the response of a version not found handler, see `NotFoundHandlerWith`.
+type NotFoundOptions struct {
+	// StatusCode defaults to 501 Not Implemented, same as the `NotFoundHandler`.
+	StatusCode int
+	// Body defaults to "version not found".
+	Body string
+	// ContentType, if not empty, is sent as the "Content-Type" response header,
+	// i.e "application/json" for a JSON body.
+	ContentType string
+}
+
+// NotFoundHandlerWith returns a version not found handler
+// which responds with the given status code and body instead of the `NotFoundHandler`'s ones.
+// It can be used as the `NotFound` entry of a `Map` or as the not found handler of the `RegisterGroups`.
+func NotFoundHandlerWith(options NotFoundOptions) http.Handler {
+	if options.StatusCode == 0 {
+		options.StatusCode = http.StatusNotImplemented
+	}
+
+	body := versionNotFoundText
+	if options.Body != "" {
+		body = []byte(options.Body)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if options.ContentType != "" {
+			w.Header().Set("Content-Type", options.ContentType)
+		}
+
+		w.WriteHeader(options.StatusCode)
+		w.Write(body)
+	})
+}
+
+// MultipleChoicesHandler returns a version not found handler which responds with 300 Multiple Choices
+// and a body of the supported "versions", one per line, so the clients can pick one of them.
+// If "versions" is nil then the registered versions of the matcher are listed instead, see `GetSupportedVersions`.
+// It can be used as the `NotFound` entry of a `Map` or as the not found handler of the `RegisterGroups`.
+// Use the `MultipleChoicesHandlerWith` to send the locations of the versions too.
+//
+// Example:
+//
+//	versioning.NewMatcher(versioning.Map{
+//		"1.0":               v1Handler,
+//		">= 2, < 3":         v2Handler,
+//		versioning.NotFound: versioning.MultipleChoicesHandler(nil),
+//	})
+func MultipleChoicesHandler(versions []string) http.Handler {
+	return MultipleChoicesHandlerWith(MultipleChoicesOptions{Versions: versions})
+}
+
+// MultipleChoicesOptions describes the response of the `MultipleChoicesHandlerWith`.
+type MultipleChoicesOptions struct {
+	// Versions are the supported versions, defaults to the registered versions of the matcher.
+	Versions []string
+	// Location, if not nil, returns the URL of the "version" of the requested resource,
+	// e.g. "https://api.example.com/v2/users". An empty location is not sent.
+	Location func(r *http.Request, version string) string
+}
+
+// MultipleChoicesHandlerWith same as `MultipleChoicesHandler` but it sends the location of each version too,
+// as a "Link" response header, i.e Link: <https://api.example.com/v2/users>; rel="alternate"; version=">= 2, < 3",
+// and next to the version on its body line, separated by a space.
+//
+// Example:
+//
+//	versioning.MultipleChoicesHandlerWith(versioning.MultipleChoicesOptions{
+//		Location: func(r *http.Request, version string) string {
+//			return "https://api.example.com/docs/versions/" + url.PathEscape(version)
+//		},
+//	})
+func MultipleChoicesHandlerWith(options MultipleChoicesOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		supported := options.Versions
+		if supported == nil {
+			supported = GetSupportedVersions(r)
+		}
+
+		lines := make([]string, 0, len(supported))
+		for _, v := range supported {
+			line := v
+			if options.Location != nil {
+				if location := options.Location(r, v); location != "" {
+					w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"alternate\"; version=%q", location, v))
+					line += " " + location
+				}
+			}
+
+			lines = append(lines, line)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMultipleChoices)
+		for _, line := range lines {
+			w.Write([]byte(line + "\n"))
+		}
+	})
+}
+
+// NotAcceptableHandler returns a version not found handler which responds with 406 Not Acceptable
+// and an "Accept-Version" response header of the supported "versions", e.g. "1.0 || >=2 <3",
+// so the clients can correct their requested version. Each version is rendered as a range separated by spaces
+// and the versions are separated by "||", so the header value can be sent back as it is, see `NewMatcher`.
+// If "versions" is nil then the registered versions of the matcher are sent instead, see `GetSupportedVersions`.
+// It can be used as the `NotFound` entry of a `Map` or as the not found handler of the `RegisterGroups`.
+func NotAcceptableHandler(versions []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		supported := versions
+		if supported == nil {
+			supported = GetSupportedVersions(r)
+		}
+
+		alternatives := make([]string, 0, len(supported))
+		for _, v := range supported {
+			alternatives = append(alternatives, spaceSeparatedConstraint(v))
+		}
+
+		w.Header().Set(acceptVersionHeaderKey(), strings.Join(alternatives, " || "))
+		w.WriteHeader(http.StatusNotAcceptable)
+		w.Write(versionNotFoundText)
+	})
+}
+
+// ProblemOptions describes the RFC 7807 problem details of the `ProblemNotFoundHandler`.
+type ProblemOptions struct {
+	// Type is the URI reference of the problem type, defaults to "about:blank".
+	Type string
+	// Title is the short summary of the problem type, defaults to "Version Not Found".
+	Title string
+	// StatusCode defaults to 501 Not Implemented, same as the `NotFoundHandler`.
+	StatusCode int
+}
+
+// problem is the "application/problem+json" body of the `ProblemNotFoundHandler`.
+type problem struct {
+	Type              string   `json:"type"`
+	Title             string   `json:"title"`
+	Status            int      `json:"status"`
+	Detail            string   `json:"detail"`
+	RequestedVersion  string   `json:"requestedVersion,omitempty"`
+	SupportedVersions []string `json:"supportedVersions"`
+}
+
+// ProblemNotFoundHandler returns a version not found handler which responds with
+// an RFC 7807 "application/problem+json" body of the requested version (see `GetRequestedVersion`)
+// and the registered versions of the matcher (see `GetSupportedVersions`).
+// It can be used as the `NotFound` entry of a `Map` or as the not found handler of the `RegisterGroups`.
+//
+// Example body:
+//
+//	{
+//	  "type": "about:blank",
+//	  "title": "Version Not Found",
+//	  "status": 501,
+//	  "detail": "version \"3.0\" is not supported",
+//	  "requestedVersion": "3.0",
+//	  "supportedVersions": ["1.0", ">= 2, < 3"]
+//	}
+func ProblemNotFoundHandler(options ProblemOptions) http.Handler {
+	if options.Type == "" {
+		options.Type = "about:blank"
+	}
+
+	if options.Title == "" {
+		options.Title = "Version Not Found"
+	}
+
+	if options.StatusCode == 0 {
+		options.StatusCode = http.StatusNotImplemented
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := problem{
+			Type:              options.Type,
+			Title:             options.Title,
+			Status:            options.StatusCode,
+			Detail:            "a version is required",
+			SupportedVersions: GetSupportedVersions(r),
+		}
+
+		if requested := GetRequestedVersion(r); requested != NotFound {
+			body.RequestedVersion = requested
+			body.Detail = fmt.Sprintf("version %q is not supported", requested)
+		}
+
+		if body.SupportedVersions == nil {
+			body.SupportedVersions = []string{}
+		}
+
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(options.StatusCode)
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// GetSupportedVersions returns the registered versions of the matcher by their precedence (see `Map`),
+// it's available to the version not found handler only. It returns nil if the request was not served by a matcher.
+func GetSupportedVersions(r *http.Request) []string {
+	versions, _ := r.Context().Value(supportedContextKey{}).([]string)
+	return versions
+}
+
+// VersionExtractor is a function which reads the requested version from a request.
+// It should return the `NotFound`, or an empty string, when the request does not contain a version.
+//
+// See `GetVersion` (the default one) and the `Extractor` matcher option.
+type VersionExtractor func(r *http.Request) string
+
+// VersionSource reads the requested version from a part of the request, e.g. a header.
+// It reports false if that part does not contain a version, so the next source is consulted.
+// A source can also stop the resolution by returning the `NotFound` and false,
+// i.e when a middleware explicitly tells that the version was not found.
+//
+// See `VersionSources` and the `Sources` matcher option.
+type VersionSource func(r *http.Request) (string, bool)
+
+// VersionSources are the sources that `GetVersion` consults by order.
+// Defaults to the request context (see `WithVersion`), the "Accept-Version" and the "Accept" headers.
+// It can be modified to change their priority or to add other sources, e.g. the url query:
+//
+//	versioning.VersionSources = []versioning.VersionSource{
+//		versioning.ExtractorSource(versioning.FromQuery("api-version")),
+//		versioning.VersionFromAcceptVersion,
+//	}
+var VersionSources = []VersionSource{VersionFromContext, VersionFromAcceptVersion, VersionFromAccept}
+
+// VersionFromContext is a `VersionSource` which reads the version of the request context, see `WithVersion`.
+// An explicit `NotFound` (or empty) version stops the resolution.
+func VersionFromContext(r *http.Request) (string, bool) {
+	version, ok := r.Context().Value(contextKey{}).(string)
+	if !ok {
+		return "", false
+	}
+
+	if version == "" || version == NotFound {
+		return NotFound, false
+	}
+
+	return version, true
+}
+
+// VersionFromAcceptVersion is a `VersionSource` which reads the "Accept-Version" header (see `AcceptVersionHeaderKey`).
+func VersionFromAcceptVersion(r *http.Request) (string, bool) {
+	version := r.Header.Get(acceptVersionHeaderKey())
+	return version, version != ""
+}
+
+// VersionFromAccept is a `VersionSource` which reads the "Accept" header,
+// i.e Accept: "application/json; version=1.0" or Accept: "application/vnd.myapi.v2+json".
+func VersionFromAccept(r *http.Request) (string, bool) {
+	acceptValue := r.Header.Get(AcceptHeaderKey)
+	if acceptValue == "" {
+		return "", false
+	}
+
+	version := getVersionFromAccept(acceptValue)
+	return version, version != ""
+}
+
+// ExtractorSource converts a `VersionExtractor`, e.g. the `FromQuery` one, to a `VersionSource`.
+func ExtractorSource(extractor VersionExtractor) VersionSource {
+	return func(r *http.Request) (string, bool) {
+		if version := extractor(r); version != "" && version != NotFound {
+			return version, true
+		}
+
+		return "", false
+	}
+}
+
 // GetVersion returns the current request version.
 //
 // By default the `GetVersion` will try to read from:
@@ -52,55 +354,540 @@ var NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Reque
 //
 // However, the end developer can also set a custom version for a handler trough a middleware by using the request's context's value
 // for versions (see `WithVersion` for further details on that).
+// The sources and their priority can be modified through the `VersionSources`.
 func GetVersion(r *http.Request) string {
-	// firstly by context store, if manually set-ed by a middleware.
-	if v := r.Context().Value(contextKey); v != nil {
-		if version, ok := v.(string); ok {
+	if version, ok := GetVersionOK(r); ok {
+		return version
+	}
+
+	return NotFound
+}
+
+// GetVersionOK same as `GetVersion` but it reports whether the request contains a version
+// instead of returning the `NotFound`. Useful to not compare against the `NotFound`,
+// which a client could even send as a version.
+func GetVersionOK(r *http.Request) (string, bool) {
+	return resolveVersion(r, VersionSources)
+}
+
+// resolveVersion returns the version of the first source that contains one.
+func resolveVersion(r *http.Request, sources []VersionSource) (string, bool) {
+	for _, source := range sources {
+		version, ok := source(r)
+		if ok {
+			return version, true
+		}
+
+		if version == NotFound {
+			return NotFound, false
+		}
+	}
+
+	return "", false
+}
+
+// getVersionFromAccept returns the "version" parameter of the first media range that contains one,
+// i.e "application/json; version=1.0" or `application/json; version="1.0"`,
+// or the version of a vendor media type, i.e "application/vnd.myapi.v2+json" (see `AcceptVendorPrefix`).
+// It returns empty string if not found.
+func getVersionFromAccept(acceptValue string) string {
+	for _, mediaRange := range splitQuoted(acceptValue, ',') {
+		params := splitQuoted(mediaRange, ';')
+		if version := getVersionFromVendor(params[0]); version != "" {
 			return version
 		}
+
+		for _, param := range params {
+			key, value, ok := strings.Cut(param, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), AcceptHeaderVersionValue) {
+				continue
+			}
+
+			value = strings.TrimSpace(value)
+			if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+				value = strings.TrimSpace(value[1 : len(value)-1])
+			}
+
+			if value != "" {
+				return value
+			}
+		}
+	}
+
+	return ""
+}
+
+// getVersionFromVendor returns the version of a vendor media type,
+// i.e "application/vnd.myapi.v2+json" results to "2" and "application/vnd.myapi.v2.1+json" to "2.1".
+// It returns empty string if the "mediaType" does not start with the `AcceptVendorPrefix` or it has no version.
+func getVersionFromVendor(mediaType string) string {
+	mediaType = strings.TrimSpace(mediaType)
+	if AcceptVendorPrefix == "" || len(mediaType) < len(AcceptVendorPrefix) ||
+		!strings.EqualFold(mediaType[:len(AcceptVendorPrefix)], AcceptVendorPrefix) {
+		return ""
+	}
+
+	subtype := mediaType[len(AcceptVendorPrefix):]
+	if idx := strings.IndexByte(subtype, '+'); idx != -1 { // i.e "+json".
+		subtype = subtype[:idx]
+	}
+
+	labels := strings.Split(subtype, ".")
+	for i, label := range labels {
+		if version, ok := trimVersionLabel(label); ok {
+			return appendVersionLabels(version, labels[i+1:])
+		}
+	}
+
+	return ""
+}
+
+// splitQuoted splits "s" by the "sep" which are not inside double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
 	}
 
-	// secondly by the "Accept-Version" header.
-	if version := r.Header.Get(AcceptVersionHeaderKey); version != "" {
+	return append(parts, s[start:])
+}
+
+// GetVersionFromPath returns the version of the first path segment after the "prefix",
+// the segment should be a "v" followed by the version number, i.e "v1" or "v2.5".
+// The leading "v" is removed, so a request path of "/api/v2/cats" with a "/api" prefix results to "2".
+//
+// It returns the `NotFound` when the path does not start with the "prefix"
+// or the version segment is missing.
+func GetVersionFromPath(r *http.Request, prefix string) string {
+	path := r.URL.Path
+
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix = "/" + prefix
+		if !strings.HasPrefix(path, prefix) {
+			return NotFound
+		}
+
+		path = path[len(prefix):]
+		if path != "" && path[0] != '/' { // i.e "/apiv2" with "/api" prefix.
+			return NotFound
+		}
+	}
+
+	segment := strings.TrimPrefix(path, "/")
+	if idx := strings.IndexByte(segment, '/'); idx != -1 {
+		segment = segment[:idx]
+	}
+
+	if version, ok := trimVersionLabel(segment); ok {
 		return version
 	}
 
-	// thirdly by the "Accept" header which is like"...; version=1.0"
-	acceptValue := r.Header.Get(AcceptHeaderKey)
-	if acceptValue != "" {
-		if idx := strings.Index(acceptValue, AcceptHeaderVersionValue); idx != -1 {
-			rem := acceptValue[idx:]
-			startVersion := strings.Index(rem, "=")
-			if startVersion == -1 || len(rem) < startVersion+1 {
-				return NotFound
+	return NotFound
+}
+
+// FromPath returns a `VersionExtractor` which reads the version from the request path,
+// see `GetVersionFromPath` for more.
+func FromPath(prefix string) VersionExtractor {
+	return func(r *http.Request) string {
+		return GetVersionFromPath(r, prefix)
+	}
+}
+
+// GetVersionFromHost returns the version of the first label of the request host,
+// the label should be a "v" followed by the version number, i.e "v2.api.example.com" results to "2".
+// The next numeric labels are the minor and patch versions, i.e "v2.5.api.example.com" results to "2.5".
+// The port of the host is ignored and the "v" can be uppercase.
+//
+// It returns the `NotFound` when the host does not start with a version label.
+// It can be passed as it's to the `Extractor` matcher option.
+func GetVersionFromHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	labels := strings.Split(host, ".")
+	version, ok := trimVersionLabel(labels[0])
+	if !ok {
+		return NotFound
+	}
+
+	// the last label is the top-level domain, i.e "v2.5" is not a "5" domain.
+	if labels = labels[1:]; len(labels) > 0 {
+		labels = labels[:len(labels)-1]
+	}
+
+	return appendVersionLabels(version, labels)
+}
+
+// appendVersionLabels appends the leading numeric "labels" to the "version" as its minor and patch versions,
+// i.e "2" and ["5", "api"] results to "2.5".
+func appendVersionLabels(version string, labels []string) string {
+	for i := 0; i < len(labels) && i < 2 && isNumeric(labels[i]); i++ {
+		version += "." + labels[i]
+	}
+
+	return version
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetVersionFromQuery returns the version of the "paramName" url query parameter,
+// i.e "?api-version=2.5" or "?api-version=v2.5" results to "2.5".
+//
+// It returns the `NotFound` when the parameter is missing or empty.
+func GetVersionFromQuery(r *http.Request, paramName string) string {
+	version := normalizeVersion(r.URL.Query().Get(paramName))
+	if version == "" {
+		return NotFound
+	}
+
+	return version
+}
+
+// FromQuery returns a `VersionExtractor` which reads the version from the "paramName" url query parameter,
+// see `GetVersionFromQuery` for more.
+func FromQuery(paramName string) VersionExtractor {
+	return func(r *http.Request) string {
+		return GetVersionFromQuery(r, paramName)
+	}
+}
+
+// maxFormBodySize is the maximum size of a form body which `GetVersionFromForm` reads,
+// same as the `http.Request.ParseForm`'s one.
+const maxFormBodySize = 10 << 20 // 10 MB.
+
+// GetVersionFromForm returns the version of the "field" of the url-encoded form body, or the url query,
+// i.e "api-version=2.5" or "api-version=v2.5" results to "2.5", useful for RPC-style POST APIs.
+// The body is read only for POST, PUT and PATCH requests of the "application/x-www-form-urlencoded" content type
+// and up to 10MB, the rest of the requests are looked up by their url query.
+// The request body is restored after parsing, so the next handlers can still read it,
+// and an already parsed form (see `http.Request.ParseForm`) is used as it is.
+//
+// It returns the `NotFound` when the field is missing or empty, or when the body was already consumed.
+func GetVersionFromForm(r *http.Request, field string) string {
+	form := r.Form
+	if form == nil {
+		if !hasFormBody(r) {
+			form = r.URL.Query()
+		} else if form = parseFormBody(r); form == nil {
+			return NotFound
+		}
+	}
+
+	version := normalizeVersion(form.Get(field))
+	if version == "" {
+		return NotFound
+	}
+
+	return version
+}
+
+// hasFormBody reports whether the "r" is a POST, PUT or PATCH request of an url-encoded form body.
+func hasFormBody(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return false
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && contentType == "application/x-www-form-urlencoded"
+}
+
+// parseFormBody parses the form body of the "r" and restores its body.
+// It returns nil on read or parse errors and the url query when the body is larger than the `maxFormBodySize`.
+func parseFormBody(r *http.Request) url.Values {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxFormBodySize+1))
+	if err != nil || len(body) > maxFormBodySize {
+		// give back what was read, the rest of the body is still unread.
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+		if err != nil {
+			return nil
+		}
+
+		return r.URL.Query()
+	}
+
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	err = r.ParseForm()
+	r.Body = io.NopCloser(bytes.NewReader(body)) // the ParseForm consumed it.
+	if err != nil {
+		return nil
+	}
+
+	return r.Form
+}
+
+// FromForm returns a `VersionExtractor` which reads the version from the "field" of the form body,
+// see `GetVersionFromForm` for more.
+func FromForm(field string) VersionExtractor {
+	return func(r *http.Request) string {
+		return GetVersionFromForm(r, field)
+	}
+}
+
+// FromContextKey returns a `VersionExtractor` which reads the version from a request context value
+// of a caller-provided "key", e.g. the one a router or another middleware stores the version to.
+// It returns the `NotFound` when the value is missing or it's not a non-empty string.
+func FromContextKey(key interface{}) VersionExtractor {
+	return func(r *http.Request) string {
+		if version, ok := r.Context().Value(key).(string); ok && version != "" {
+			return version
+		}
+
+		return NotFound
+	}
+}
+
+// Chain returns a `VersionExtractor` which tries the given extractors by order
+// and returns the first found version, i.e
+// Chain(FromPath("/api"), GetVersion) prefers the path's version over the headers.
+func Chain(extractors ...VersionExtractor) VersionExtractor {
+	return func(r *http.Request) string {
+		for _, extractor := range extractors {
+			if version := extractor(r); version != "" && version != NotFound {
+				return version
 			}
+		}
 
-			rem = rem[startVersion+1:]
+		return NotFound
+	}
+}
 
-			end := strings.Index(rem, " ")
-			if end == -1 {
-				end = strings.Index(rem, ";")
+// CapTo returns a `VersionExtractor` which reads the version of the "requested" extractor
+// but never above the version of the "ceiling" one, i.e the effective version is the lowest of them,
+// e.g. a version of the request context set by an authentication middleware based on the client's plan.
+// The client can request a lower version but not a higher one, a request without a version or of the `Latest` gets the ceiling.
+// Each version of a list is capped, e.g. "3.0, 1.0" results to "2.0, 1.0" for a "2.0" ceiling,
+// and a range of versions is limited, e.g. ">= 1" results to ">= 1, <= 2.0.0". The versions are compared as semver ones.
+//
+// Example:
+//
+//	versioning.NewMatcher(versions, versioning.Extractor(
+//		versioning.CapTo(versioning.FromContextKey(planVersionKey), versioning.GetVersion)))
+func CapTo(ceiling, requested VersionExtractor) VersionExtractor {
+	return func(r *http.Request) string {
+		max, version := ceiling(r), requested(r)
+		if version == "" || version == NotFound {
+			return max
+		}
+
+		if max == "" || max == NotFound {
+			return version
+		}
+
+		if version == Latest {
+			return max
+		}
+
+		return capVersion(version, max)
+	}
+}
+
+// normalizeVersion trims the surrounding whitespace and a leading "v" or "V" of a version,
+// e.g. " V2.5 " results to "2.5". The "v" is kept if it's not followed by a number, e.g. "vabc".
+func normalizeVersion(version string) string {
+	version = strings.TrimSpace(version)
+	if len(version) > 1 && (version[0] == 'v' || version[0] == 'V') && version[1] >= '0' && version[1] <= '9' {
+		version = version[1:]
+	}
+
+	return version
+}
+
+// trimVersionLabel reports whether the "label" is a "v" followed by a numeric version (e.g. "v1", "v2.5")
+// and returns the version without the "v".
+func trimVersionLabel(label string) (string, bool) {
+	if len(label) < 2 || (label[0] != 'v' && label[0] != 'V') {
+		return "", false
+	}
+
+	version := label[1:]
+	for i := 0; i < len(version); i++ {
+		if c := version[i]; c == '.' {
+			if i == 0 || i == len(version)-1 || version[i-1] == '.' {
+				return "", false
 			}
-			if end == -1 {
-				end = len(rem)
+		} else if c < '0' || c > '9' {
+			return "", false
+		}
+	}
+
+	return version, true
+}
+
+// parseVersionList parses a comma separated list of versions with optional quality values,
+// e.g. "2.0, 1.0;q=0.5", and returns the versions sorted by their quality, highest first.
+// Versions with a zero quality are not acceptable and are excluded.
+func parseVersionList(value string) []string {
+	if !strings.ContainsAny(value, ",;") {
+		return []string{value}
+	}
+
+	type candidate struct {
+		version string
+		quality float64
+	}
+
+	parts := strings.Split(value, ",")
+	candidates := make([]candidate, 0, len(parts))
+	for _, part := range parts {
+		version, params, _ := strings.Cut(part, ";")
+		version = strings.TrimSpace(version)
+		if version == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(key) != "q" {
+				continue
 			}
 
-			if version := rem[:end]; version != "" {
-				return version
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = q
 			}
 		}
+
+		if quality <= 0 {
+			continue
+		}
+
+		candidates = append(candidates, candidate{version: version, quality: quality})
 	}
 
-	return NotFound
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+
+	versions := make([]string, len(candidates))
+	for i, c := range candidates {
+		versions[i] = c.version
+	}
+
+	return versions
+}
+
+// varyVersion adds the request headers that `GetVersion` reads to the "Vary" response header,
+// so caches do not serve a response of a version to a client of another version.
+func varyVersion(h http.Header, r *http.Request) {
+	key := acceptVersionHeaderKey()
+	if r.Header.Get(key) != "" {
+		addVary(h, key)
+		return
+	}
+
+	addVary(h, key, AcceptHeaderKey)
+}
+
+// addVary appends the "keys" to the "Vary" header, if they are not already there.
+func addVary(h http.Header, keys ...string) {
+	existing := h.Values("Vary")
+
+	for _, key := range keys {
+		found := false
+		for _, value := range existing {
+			for _, token := range strings.Split(value, ",") {
+				if token = strings.TrimSpace(token); token == "*" || strings.EqualFold(token, key) {
+					found = true
+					break
+				}
+			}
+		}
+
+		if !found {
+			h.Add("Vary", key)
+			existing = h.Values("Vary")
+		}
+	}
+}
+
+func acceptVersionHeaderKey() string {
+	if AcceptVersionHeaderKey == "" {
+		return defaultAcceptVersionHeaderKey
+	}
+
+	return AcceptVersionHeaderKey
 }
 
 // WithVersion creates the new context that contains a passed version.
 // Example of how you can change the default behavior to extract a requested version (which is by headers)
 // from a "version" url parameter instead:
-// func(w http.ResponseWriter, r *http.Request) { // &version=1
-// 	r = r.WithContext(versioning.WithVersion(r.Context(), r.URL.Query().Get("version")))
-// 	nextHandler.ServeHTTP(w,r)
-// }
+//
+//	func(w http.ResponseWriter, r *http.Request) { // &version=1
+//		r = r.WithContext(versioning.WithVersion(r.Context(), r.URL.Query().Get("version")))
+//		nextHandler.ServeHTTP(w,r)
+//	}
+//
+// For the url parameter case the `FromQuery` extractor can be passed to the `NewMatcher` instead,
+// or the same middleware can be created by `SetVersionMiddleware(FromQuery("version"))`.
 func WithVersion(ctx context.Context, version string) context.Context {
-	return context.WithValue(ctx, contextKey, version)
-}
\ No newline at end of file
+	return context.WithValue(ctx, contextKey{}, version)
+}
+
+// SetVersionMiddleware returns a middleware which stores the version of the "extractor" to the request context,
+// see `WithVersion`, before it calls the next handler, i.e
+// SetVersionMiddleware(FromQuery("version"))(router) makes the "?version=1" the current version.
+// A nil "extractor" or an empty or `NotFound` version leaves the request context untouched.
+func SetVersionMiddleware(extractor VersionExtractor) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if extractor != nil {
+				if version := extractor(r); version != "" && version != NotFound {
+					r = r.WithContext(WithVersion(r.Context(), version))
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetRequestedVersion returns the version as it was requested by the client,
+// before any default or matching, e.g. "3.0" or even an invalid one like "banana".
+// It's set by the `NewMatcher` so a not found handler can report what was asked for,
+// the nested matchers keep the one of the outermost matcher.
+// It returns the `NotFound` when the request did not contain a version.
+func GetRequestedVersion(r *http.Request) string {
+	if version, ok := r.Context().Value(requestedContextKey{}).(string); ok {
+		return version
+	}
+
+	return NotFound
+}
@@ -2,8 +2,10 @@ package versioning_test
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/kataras/versioning"
@@ -66,3 +68,654 @@ func TestGetVersion(t *testing.T) {
 		statusCode(http.StatusOK).
 		bodyEq("11.0.5")
 }
+
+func TestGetVersionOK(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if version, ok := versioning.GetVersionOK(r); ok || version != "" {
+		t.Fatalf("expected no version but got: '%s'", version)
+	}
+
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "1.0")
+	if version, ok := versioning.GetVersionOK(r); !ok || version != "1.0" {
+		t.Fatalf("expected version: '1.0' but got: '%s' (%v)", version, ok)
+	}
+
+	// a client sending the NotFound literally is distinguishable.
+	r.Header.Set(versioning.AcceptVersionHeaderKey, versioning.NotFound)
+	if version, ok := versioning.GetVersionOK(r); !ok || version != versioning.NotFound {
+		t.Fatalf("expected version: '%s' but got: '%s' (%v)", versioning.NotFound, version, ok)
+	}
+
+	// a middleware can still tell that the version was not found.
+	r = r.WithContext(versioning.WithVersion(r.Context(), versioning.NotFound))
+	if version, ok := versioning.GetVersionOK(r); ok {
+		t.Fatalf("expected no version but got: '%s'", version)
+	}
+}
+
+func TestContextKeyCollision(t *testing.T) {
+	// another package which stores an unrelated value under the same string key.
+	ctx := context.WithValue(context.Background(), "api.version", "other")
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+	if version := versioning.GetVersion(r); version != versioning.NotFound {
+		t.Fatalf("expected no version but got: '%s'", version)
+	}
+
+	r = r.WithContext(versioning.WithVersion(r.Context(), "2.0"))
+	if expected, got := "2.0", versioning.GetVersion(r); expected != got {
+		t.Fatalf("expected version: '%s' but got: '%s'", expected, got)
+	}
+	if expected, got := "other", r.Context().Value("api.version"); expected != got {
+		t.Fatalf("expected the other package's value: '%s' but got: '%v'", expected, got)
+	}
+
+	// the other package's key can still be read explicitly.
+	if expected, got := "other", versioning.FromContextKey("api.version")(r); expected != got {
+		t.Fatalf("expected version: '%s' but got: '%s'", expected, got)
+	}
+	if expected, got := versioning.NotFound, versioning.FromContextKey("missing")(r); expected != got {
+		t.Fatalf("expected version: '%s' but got: '%s'", expected, got)
+	}
+}
+
+func TestVersionSources(t *testing.T) {
+	defer func(sources []versioning.VersionSource) { versioning.VersionSources = sources }(versioning.VersionSources)
+
+	r := httptest.NewRequest(http.MethodGet, "/?api-version=3.0", nil)
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "2.0")
+	r = r.WithContext(versioning.WithVersion(r.Context(), "1.0"))
+
+	if expected, got := "1.0", versioning.GetVersion(r); expected != got {
+		t.Fatalf("expected the context version: '%s' but got '%s'", expected, got)
+	}
+
+	// the header wins over a context default.
+	versioning.VersionSources = []versioning.VersionSource{versioning.VersionFromAcceptVersion, versioning.VersionFromContext}
+	if expected, got := "2.0", versioning.GetVersion(r); expected != got {
+		t.Fatalf("expected the header version: '%s' but got '%s'", expected, got)
+	}
+
+	// the query wins over the headers.
+	versioning.VersionSources = []versioning.VersionSource{
+		versioning.ExtractorSource(versioning.FromQuery("api-version")),
+		versioning.VersionFromAcceptVersion,
+	}
+	if expected, got := "3.0", versioning.GetVersion(r); expected != got {
+		t.Fatalf("expected the query version: '%s' but got '%s'", expected, got)
+	}
+
+	// an explicit not found version stops the resolution.
+	versioning.VersionSources = []versioning.VersionSource{versioning.VersionFromContext, versioning.VersionFromAcceptVersion}
+	r = r.WithContext(versioning.WithVersion(r.Context(), versioning.NotFound))
+	if version, ok := versioning.GetVersionOK(r); ok {
+		t.Fatalf("expected no version but got: '%s'", version)
+	}
+}
+
+func TestGetVersionFromAcceptHeader(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"application/json; version=1.0", "1.0"},
+		{`application/json; version="1.0"`, "1.0"},
+		{"application/json;\tversion=1.0", "1.0"},
+		{"application/json;version=1.0,", "1.0"},
+		{"application/json; version=1.0, text/html", "1.0"},
+		{"text/html, application/json; version=2.0", "2.0"},
+		{"application/json; charset=utf-8; Version=3", "3"},
+		{`application/json; other="a;version=9"; version=2`, "2"},
+		{"application/version+json; version=1.5", "1.5"},
+		{"application/version+json", versioning.NotFound},
+		{"application/json; versions=1.0", versioning.NotFound},
+		{"application/json; myversion=1.0", versioning.NotFound},
+		{`application/json; version=""`, versioning.NotFound},
+		{"application/json; version", versioning.NotFound},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(versioning.AcceptHeaderKey, tt.accept)
+		if got := versioning.GetVersion(r); tt.expected != got {
+			t.Fatalf("[%s]: expected version: '%s' but got '%s'", tt.accept, tt.expected, got)
+		}
+	}
+}
+
+func TestGetVersionCustomHeaderKey(t *testing.T) {
+	defer func(key string) { versioning.AcceptVersionHeaderKey = key }(versioning.AcceptVersionHeaderKey)
+
+	versioning.AcceptVersionHeaderKey = "X-Api-Version"
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Api-Version", "2.0")
+	r.Header.Set("Accept-Version", "1.0")
+	if expected, got := "2.0", versioning.GetVersion(r); expected != got {
+		t.Fatalf("expected version: '%s' but got '%s'", expected, got)
+	}
+
+	// the "Accept" header is still a fallback.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(versioning.AcceptHeaderKey, "application/json; version=3.0")
+	if expected, got := "3.0", versioning.GetVersion(r); expected != got {
+		t.Fatalf("expected version: '%s' but got '%s'", expected, got)
+	}
+
+	// an empty key fallbacks to the "Accept-Version".
+	versioning.AcceptVersionHeaderKey = ""
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Version", "1.0")
+	if expected, got := "1.0", versioning.GetVersion(r); expected != got {
+		t.Fatalf("expected version: '%s' but got '%s'", expected, got)
+	}
+}
+
+func TestGetVersionFromAcceptVendor(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"application/vnd.myapi.v2+json", "2"},
+		{"application/VND.myapi.V2.1+json", "2.1"},
+		{"application/vnd.myapi.v2.1.3", "2.1.3"},
+		{"text/html, application/vnd.myapi.v3+json;q=0.9", "3"},
+		{"application/vnd.myapi+json; version=1.0", "1.0"},
+		{"application/vnd.myapi.v2+json; version=1.0", "2"},
+		{"application/vnd.myapi+json", versioning.NotFound},
+		{"application/vnd.myapi.version+json", versioning.NotFound},
+		{"application/json", versioning.NotFound},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(versioning.AcceptHeaderKey, tt.accept)
+		if got := versioning.GetVersion(r); tt.expected != got {
+			t.Fatalf("[%s]: expected version: '%s' but got '%s'", tt.accept, tt.expected, got)
+		}
+	}
+
+	defer func(prefix string) { versioning.AcceptVendorPrefix = prefix }(versioning.AcceptVendorPrefix)
+
+	versioning.AcceptVendorPrefix = "application/vnd.myapi."
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(versioning.AcceptHeaderKey, "application/vnd.other.v2+json")
+	if got := versioning.GetVersion(r); got != versioning.NotFound {
+		t.Fatalf("expected no version of other vendors but got '%s'", got)
+	}
+
+	r.Header.Set(versioning.AcceptHeaderKey, "application/vnd.myapi.v4+json")
+	if expected, got := "4", versioning.GetVersion(r); expected != got {
+		t.Fatalf("expected version: '%s' but got '%s'", expected, got)
+	}
+
+	versioning.AcceptVendorPrefix = ""
+	if got := versioning.GetVersion(r); got != versioning.NotFound {
+		t.Fatalf("expected the vendor media types to be ignored but got '%s'", got)
+	}
+}
+
+func TestGetVersionFromPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		prefix   string
+		expected string
+	}{
+		{"/v1/users", "", "1"},
+		{"/V2.5/users", "/", "2.5"},
+		{"/v1", "", "1"},
+		{"/api/v2/cats", "/api", "2"},
+		{"/api/v2.1.3/cats", "api/", "2.1.3"},
+		{"/users", "", versioning.NotFound},
+		{"/version/users", "", versioning.NotFound},
+		{"/v1./users", "", versioning.NotFound},
+		{"/v/users", "", versioning.NotFound},
+		{"/apiv2/cats", "/api", versioning.NotFound},
+		{"/other/v2/cats", "/api", versioning.NotFound},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if got := versioning.GetVersionFromPath(r, tt.prefix); tt.expected != got {
+			t.Fatalf("[%s] with prefix [%s]: expected version: '%s' but got '%s'", tt.path, tt.prefix, tt.expected, got)
+		}
+	}
+}
+
+func TestGetVersionFromForm(t *testing.T) {
+	newRequest := func(body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+
+	r := newRequest("method=users.list&api-version=v2.5")
+	if expected, got := "2.5", versioning.GetVersionFromForm(r, "api-version"); expected != got {
+		t.Fatalf("expected version %q but got %q", expected, got)
+	}
+	// the body is restored.
+	if body, _ := io.ReadAll(r.Body); string(body) != "method=users.list&api-version=v2.5" {
+		t.Fatalf("expected the body to be restored but got %q", body)
+	}
+
+	if got := versioning.GetVersionFromForm(newRequest("method=users.list"), "api-version"); got != versioning.NotFound {
+		t.Fatalf("expected not found version but got %q", got)
+	}
+	if got := versioning.GetVersionFromForm(newRequest("api-version="), "api-version"); got != versioning.NotFound {
+		t.Fatalf("expected not found version for an empty field but got %q", got)
+	}
+
+	// already consumed body.
+	r = newRequest("api-version=2.5")
+	io.ReadAll(r.Body)
+	if got := versioning.GetVersionFromForm(r, "api-version"); got != versioning.NotFound {
+		t.Fatalf("expected not found version of a consumed body but got %q", got)
+	}
+
+	// already parsed form.
+	r = newRequest("api-version=3")
+	r.ParseForm()
+	if expected, got := "3", versioning.GetVersionFromForm(r, "api-version"); expected != got {
+		t.Fatalf("expected version %q of the parsed form but got %q", expected, got)
+	}
+
+	// the url query is read too.
+	r = httptest.NewRequest(http.MethodGet, "/rpc?api-version=1.0", nil)
+	if expected, got := "1.0", versioning.GetVersionFromForm(r, "api-version"); expected != got {
+		t.Fatalf("expected version %q of the query but got %q", expected, got)
+	}
+
+	// a non-form body is not read, only the url query.
+	body := &countingReader{Reader: strings.NewReader(`{"data":"` + strings.Repeat("x", 1<<20) + `"}`)}
+	r = httptest.NewRequest(http.MethodPost, "/rpc?api-version=1.0", body)
+	r.Header.Set("Content-Type", "application/json")
+	if expected, got := "1.0", versioning.GetVersionFromForm(r, "api-version"); expected != got {
+		t.Fatalf("expected version %q of the query but got %q", expected, got)
+	}
+	if body.n != 0 {
+		t.Fatalf("expected the json body to not be read but %d bytes were read", body.n)
+	}
+
+	// a form body of a GET request is not read either.
+	r = httptest.NewRequest(http.MethodGet, "/rpc", strings.NewReader("api-version=2.5"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if got := versioning.GetVersionFromForm(r, "api-version"); got != versioning.NotFound {
+		t.Fatalf("expected not found version of a GET body but got %q", got)
+	}
+
+	// a form body larger than 10MB is not parsed but it's restored.
+	large := "api-version=2.5&data=" + strings.Repeat("x", 10<<20)
+	r = newRequest(large)
+	if got := versioning.GetVersionFromForm(r, "api-version"); got != versioning.NotFound {
+		t.Fatalf("expected not found version of a large body but got %q", got)
+	}
+	if b, _ := io.ReadAll(r.Body); len(b) != len(large) {
+		t.Fatalf("expected the large body of %d bytes to be restored but got %d bytes", len(large), len(b))
+	}
+
+	readBody := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(versioning.GetVersion(r) + ": " + string(body)))
+	})
+	matcher := versioning.NewMatcher(versioning.Map{"2.5": readBody}, versioning.Extractor(versioning.FromForm("api-version")))
+
+	w := httptest.NewRecorder()
+	matcher.ServeHTTP(w, newRequest("api-version=2.5&id=1"))
+	(&testie{t: t, resp: w.Result()}).
+		statusCode(http.StatusOK).
+		bodyEq("2.5: api-version=2.5&id=1")
+}
+
+// countingReader counts the bytes read from its Reader.
+type countingReader struct {
+	io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestCapTo(t *testing.T) {
+	type planKey struct{}
+
+	writeVersion := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versioning.GetVersion(r)))
+	})
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       writeVersion,
+		">= 2, < 3": writeVersion,
+		">= 3":      writeVersion,
+	}, versioning.Extractor(versioning.CapTo(versioning.FromContextKey(planKey{}), versioning.GetVersion)))
+
+	tests := []struct {
+		ceiling  string // empty for no ceiling.
+		header   string
+		expected string
+	}{
+		{"2.0", "3.0", "2.0"},
+		{"2.0", "v3", "2.0"},
+		{"2.0", "1.0", "1.0"},
+		{"2.0", "2.0", "2.0"},
+		{"2.0", "", "2.0"},
+		{"2.0", versioning.Latest, "2.0"},
+		{"2.0", "3.0, 1.0;q=0.5", "2.0"},
+		{"2.0", ">= 1", "2.0.0"},
+		{"2.5", ">=2 <4", "2.5.0"},
+		{"", "3.0", "3.0"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.ceiling != "" {
+			r = r.WithContext(context.WithValue(r.Context(), planKey{}, tt.ceiling))
+		}
+		if tt.header != "" {
+			r.Header.Set(versioning.AcceptVersionHeaderKey, tt.header)
+		}
+
+		w := httptest.NewRecorder()
+		matcher.ServeHTTP(w, r)
+
+		(&testie{t: t, resp: w.Result()}).
+			statusCode(http.StatusOK).
+			bodyEq(tt.expected)
+	}
+
+	// no version at all.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := versioning.CapTo(versioning.FromContextKey(planKey{}), versioning.GetVersion)(r); got != versioning.NotFound {
+		t.Fatalf("expected not found version but got %q", got)
+	}
+}
+
+func TestGetVersionFromHost(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"v2.api.example.com", "2"},
+		{"V2.api.example.com", "2"},
+		{"v2.api.example.com:8080", "2"},
+		{"v2.5.api.example.com", "2.5"},
+		{"v2.5.1.api.example.com:8080", "2.5.1"},
+		{"v2.5.1.9.example.com", "2.5.1"},
+		{"v2.5", "2"},
+		{"v2", "2"},
+		{"api.example.com", versioning.NotFound},
+		{"vendor.example.com", versioning.NotFound},
+		{"127.0.0.1:8080", versioning.NotFound},
+		{"[::1]:8080", versioning.NotFound},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = tt.host
+		if got := versioning.GetVersionFromHost(r); tt.expected != got {
+			t.Fatalf("[%s]: expected version: '%s' but got '%s'", tt.host, tt.expected, got)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	extractor := versioning.Chain(versioning.FromPath("/api"), versioning.GetVersion)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v2/cats", nil)
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "1.0")
+	if expected, got := "2", extractor(r); expected != got {
+		t.Fatalf("expected path version: '%s' but got '%s'", expected, got)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/cats", nil)
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "1.0")
+	if expected, got := "1.0", extractor(r); expected != got {
+		t.Fatalf("expected header version: '%s' but got '%s'", expected, got)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/cats", nil)
+	if expected, got := versioning.NotFound, extractor(r); expected != got {
+		t.Fatalf("expected version: '%s' but got '%s'", expected, got)
+	}
+}
+
+func TestGetVersionFromQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"?api-version=2.5", "2.5"},
+		{"?api-version=v2.5", "2.5"},
+		{"?api-version=V1", "1"},
+		{"?api-version=1&other=v2", "1"},
+		{"?api-version=", versioning.NotFound},
+		{"?other=1", versioning.NotFound},
+		{"", versioning.NotFound},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+		if got := versioning.GetVersionFromQuery(r, "api-version"); tt.expected != got {
+			t.Fatalf("[%s]: expected version: '%s' but got '%s'", tt.query, tt.expected, got)
+		}
+	}
+}
+
+func TestNotFoundHandlerWith(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0": sendHandler(v10Response),
+		versioning.NotFound: versioning.NotFoundHandlerWith(versioning.NotFoundOptions{
+			StatusCode:  http.StatusNotAcceptable,
+			Body:        `{"error": "version not supported"}`,
+			ContentType: "application/json",
+		}),
+	})
+
+	expectVersion(t, matcher, "2.0").
+		statusCode(http.StatusNotAcceptable).
+		headerEq("Content-Type", "application/json").
+		bodyEq(`{"error": "version not supported"}`)
+
+	// defaults to the NotFoundHandler's response.
+	matcher = versioning.NewMatcher(versioning.Map{
+		"1.0":               sendHandler(v10Response),
+		versioning.NotFound: versioning.NotFoundHandlerWith(versioning.NotFoundOptions{}),
+	})
+
+	expectVersion(t, matcher, "2.0").
+		statusCode(http.StatusNotImplemented).
+		bodyEq("version not found")
+}
+
+func TestMultipleChoicesHandler(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":               sendHandler(v10Response),
+		">= 2, < 3":         sendHandler(v2Response),
+		versioning.NotFound: versioning.MultipleChoicesHandler(nil),
+	})
+
+	expectVersion(t, matcher, "").
+		statusCode(http.StatusMultipleChoices).
+		headerEq("Content-Type", "text/plain; charset=utf-8").
+		bodyEq("1.0\n>= 2, < 3\n")
+	expectVersion(t, matcher, "banana").
+		statusCode(http.StatusMultipleChoices).
+		bodyEq("1.0\n>= 2, < 3\n")
+	expectVersion(t, matcher, "2.1").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+
+	group := versioning.NewGroup("1.0")
+	group.Handle("/api/users", sendHandler(v10Response))
+	routes := versioning.RegisterGroups(nil, versioning.MultipleChoicesHandler([]string{"v1"}), group)
+
+	expectVersion(t, routes["/api/users"], "3").
+		statusCode(http.StatusMultipleChoices).
+		bodyEq("v1\n")
+
+	if versions := versioning.GetSupportedVersions(httptest.NewRequest(http.MethodGet, "/", nil)); versions != nil {
+		t.Fatalf("expected no supported versions outside of a matcher but got %v", versions)
+	}
+}
+
+func TestMultipleChoicesHandlerWith(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+		versioning.NotFound: versioning.MultipleChoicesHandlerWith(versioning.MultipleChoicesOptions{
+			Location: func(r *http.Request, version string) string {
+				if version == "1.0" {
+					return "" // no location.
+				}
+
+				return "https://api.example.com/v2" + r.URL.Path
+			},
+		}),
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set(versioning.AcceptVersionHeaderKey, "3.0")
+	matcher.ServeHTTP(w, req)
+	resp := w.Result()
+	resp.Request = req
+
+	(&testie{t: t, resp: resp}).
+		statusCode(http.StatusMultipleChoices).
+		headerValuesEq("Link", `<https://api.example.com/v2/users>; rel="alternate"; version=">= 2, < 3"`).
+		bodyEq("1.0\n>= 2, < 3 https://api.example.com/v2/users\n")
+
+	// without a location it's the same as the MultipleChoicesHandler.
+	expectVersion(t, versioning.NewMatcher(versioning.Map{
+		"1.0":               sendHandler(v10Response),
+		versioning.NotFound: versioning.MultipleChoicesHandlerWith(versioning.MultipleChoicesOptions{}),
+	}), "").
+		statusCode(http.StatusMultipleChoices).
+		headerValuesEq("Link").
+		bodyEq("1.0\n")
+}
+
+func TestNotAcceptableHandler(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":               sendHandler(v10Response),
+		">= 2, < 3":         sendHandler(v2Response),
+		versioning.NotFound: versioning.NotAcceptableHandler(nil),
+	})
+
+	expectVersion(t, matcher, "3.0").
+		statusCode(http.StatusNotAcceptable).
+		headerEq(versioning.AcceptVersionHeaderKey, "1.0 || >=2 <3").
+		bodyEq("version not found")
+	expectVersion(t, matcher, "").
+		statusCode(http.StatusNotAcceptable).
+		headerEq(versioning.AcceptVersionHeaderKey, "1.0 || >=2 <3")
+	// the header value can be sent back as it is.
+	expectVersion(t, matcher, "1.0 || >=2 <3").
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+	expectVersion(t, matcher, "3.0 || >=2 <3").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	expectVersion(t, matcher, "2.1").
+		statusCode(http.StatusOK).
+		headerEq(versioning.AcceptVersionHeaderKey, "").
+		bodyEq(v2Response)
+
+	group := versioning.NewGroup("1.0")
+	group.Handle("/api/users", sendHandler(v10Response))
+	routes := versioning.RegisterGroups(nil, versioning.NotAcceptableHandler([]string{"1.0", "2.0"}), group)
+
+	expectVersion(t, routes["/api/users"], "3").
+		statusCode(http.StatusNotAcceptable).
+		headerEq(versioning.AcceptVersionHeaderKey, "1.0 || 2.0")
+
+	// an empty key fallbacks to the "Accept-Version".
+	defer func(key string) { versioning.AcceptVersionHeaderKey = key }(versioning.AcceptVersionHeaderKey)
+	versioning.AcceptVersionHeaderKey = ""
+
+	w := httptest.NewRecorder()
+	versioning.NotAcceptableHandler([]string{"1.0"}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if h := w.Result().Header; h.Get("Accept-Version") != "1.0" || len(h[""]) > 0 {
+		t.Fatalf("expected the Accept-Version header but got %v", h)
+	}
+}
+
+func TestProblemNotFoundHandler(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":               sendHandler(v10Response),
+		">= 2, < 3":         sendHandler(v2Response),
+		versioning.NotFound: versioning.ProblemNotFoundHandler(versioning.ProblemOptions{}),
+	})
+
+	expectVersion(t, matcher, "3.0").
+		statusCode(http.StatusNotImplemented).
+		headerEq("Content-Type", "application/problem+json").
+		bodyEq(`{"type":"about:blank","title":"Version Not Found","status":501,"detail":"version \"3.0\" is not supported","requestedVersion":"3.0","supportedVersions":["1.0","\u003e= 2, \u003c 3"]}` + "\n")
+	expectVersion(t, matcher, "").
+		statusCode(http.StatusNotImplemented).
+		bodyEq(`{"type":"about:blank","title":"Version Not Found","status":501,"detail":"a version is required","supportedVersions":["1.0","\u003e= 2, \u003c 3"]}` + "\n")
+	expectVersion(t, matcher, "2.1").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+
+	group := versioning.NewGroup("1.0")
+	group.Handle("/api/users", sendHandler(v10Response))
+	routes := versioning.RegisterGroups(nil, versioning.ProblemNotFoundHandler(versioning.ProblemOptions{
+		Type:       "https://example.com/problems/version",
+		Title:      "Unsupported API Version",
+		StatusCode: http.StatusNotFound,
+	}), group)
+
+	expectVersion(t, routes["/api/users"], "2").
+		statusCode(http.StatusNotFound).
+		headerEq("Content-Type", "application/problem+json").
+		bodyEq(`{"type":"https://example.com/problems/version","title":"Unsupported API Version","status":404,"detail":"version \"2\" is not supported","requestedVersion":"2","supportedVersions":["1.0"]}` + "\n")
+
+	// outside of a matcher.
+	w := httptest.NewRecorder()
+	versioning.ProblemNotFoundHandler(versioning.ProblemOptions{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	(&testie{t: t, resp: w.Result()}).
+		bodyEq(`{"type":"about:blank","title":"Version Not Found","status":501,"detail":"a version is required","supportedVersions":[]}` + "\n")
+}
+
+func TestSetVersionMiddleware(t *testing.T) {
+	writeVersion := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versioning.GetVersion(r)))
+	})
+
+	handler := versioning.SetVersionMiddleware(versioning.FromQuery("version"))(writeVersion)
+
+	tests := []struct {
+		url      string
+		header   string
+		expected string
+	}{
+		{"/?version=2.1", "1.0", "2.1"},
+		{"/?version=v3", "", "3"},
+		// empty result leaves the context untouched.
+		{"/?version=", "1.0", "1.0"},
+		{"/", "", versioning.NotFound},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		if tt.header != "" {
+			r.Header.Set(versioning.AcceptVersionHeaderKey, tt.header)
+		}
+		handler.ServeHTTP(w, r)
+
+		if got := w.Body.String(); tt.expected != got {
+			t.Fatalf("[%s]: expected version: '%s' but got '%s'", tt.url, tt.expected, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "1.0")
+	versioning.SetVersionMiddleware(nil)(writeVersion).ServeHTTP(w, r)
+	if expected, got := "1.0", w.Body.String(); expected != got {
+		t.Fatalf("expected version: '%s' but got '%s'", expected, got)
+	}
+}
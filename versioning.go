@@ -1,25 +1,40 @@
 package versioning
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/hashicorp/go-version"
 )
 
 // If reports whether the "version" is a valid match to the "is".
 // The "is" should be a version constraint like ">= 1, < 3".
+// The "version" may be prefixed by a "v", e.g. "v1.2" or "V2".
+// It reports false if the "version" or the "is" are invalid, use the `IfErr` to distinguish these cases.
+//
+// The versions are compared through the `DefaultComparer`.
 func If(v string, is string) bool {
-	ver, err := version.NewVersion(v)
+	ok, _ := IfErr(v, is)
+	return ok
+}
+
+// IfErr same as `If` but it returns an error if the "version" or the "is" cannot be parsed.
+func IfErr(v string, is string) (bool, error) {
+	ver, err := DefaultComparer.ParseVersion(normalizeVersion(v))
 	if err != nil {
-		return false
+		return false, fmt.Errorf("versioning: invalid version %q: %w", v, err)
 	}
 
-	constraints, err := version.NewConstraint(is)
+	checker, err := DefaultComparer.ParseConstraint(is)
 	if err != nil {
-		return false
+		return false, fmt.Errorf("versioning: invalid version constraint %q: %w", is, err)
 	}
 
-	return constraints.Check(ver)
+	return checker.Check(ver), nil
 }
 
 // Match reports whether the current version matches the "expectedVersion".
@@ -27,70 +42,1266 @@ func Match(r *http.Request, expectedVersion string) bool {
 	return If(GetVersion(r), expectedVersion)
 }
 
+// MatchErr same as `Match` but it returns an error if the current version or the "expectedVersion" cannot be parsed.
+// A request without a version does not match and it's not an error.
+func MatchErr(r *http.Request, expectedVersion string) (bool, error) {
+	v, ok := GetVersionOK(r)
+	if !ok {
+		if _, err := DefaultComparer.ParseConstraint(expectedVersion); err != nil {
+			return false, fmt.Errorf("versioning: invalid version constraint %q: %w", expectedVersion, err)
+		}
+
+		return false, nil
+	}
+
+	return IfErr(v, expectedVersion)
+}
+
+// MatchAny reports whether the current version matches any of the "constraints",
+// e.g. `MatchAny(r, "1.0", ">= 2, < 3")`. The invalid constraints do not match.
+func MatchAny(r *http.Request, constraints ...string) bool {
+	ok, _ := matchConstraints(r, constraints, false)
+	return ok
+}
+
+// MatchAnyErr same as `MatchAny` but it returns an error if the current version or any of the "constraints" cannot be parsed.
+// A request without a version does not match and it's not an error.
+func MatchAnyErr(r *http.Request, constraints ...string) (bool, error) {
+	ok, err := matchConstraints(r, constraints, false)
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// MatchAll reports whether the current version matches all of the "constraints",
+// e.g. `MatchAll(r, ">= 2", "!= 2.3")`. The invalid constraints do not match.
+func MatchAll(r *http.Request, constraints ...string) bool {
+	ok, _ := matchConstraints(r, constraints, true)
+	return ok
+}
+
+// MatchAllErr same as `MatchAll` but it returns an error if the current version or any of the "constraints" cannot be parsed.
+// A request without a version does not match and it's not an error.
+func MatchAllErr(r *http.Request, constraints ...string) (bool, error) {
+	ok, err := matchConstraints(r, constraints, true)
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// matchConstraints reports whether the current version matches any, or "all", of the "constraints",
+// the version is parsed once. An invalid constraint does not match and its error is returned
+// after all the constraints are checked, so the `MatchAny` and `MatchAll` can ignore it.
+func matchConstraints(r *http.Request, constraints []string, all bool) (bool, error) {
+	var (
+		ver      Version
+		firstErr error
+	)
+
+	if v, ok := GetVersionOK(r); ok {
+		parsed, err := DefaultComparer.ParseVersion(normalizeVersion(v))
+		if err != nil {
+			return false, fmt.Errorf("versioning: invalid version %q: %w", v, err)
+		}
+
+		ver = parsed
+	}
+
+	matched := all
+	for _, constraint := range constraints {
+		checker, err := DefaultComparer.ParseConstraint(constraint)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("versioning: invalid version constraint %q: %w", constraint, err)
+		}
+
+		ok := err == nil && ver != nil && checker.Check(ver)
+		if all {
+			matched = matched && ok
+		} else {
+			matched = matched || ok
+		}
+	}
+
+	return matched && ver != nil, firstErr
+}
+
+// AtLeast reports whether the current version is greater than or equal to the "v",
+// it's a shortcut of `Match(r, ">= "+v)`.
+func AtLeast(r *http.Request, v string) bool {
+	return Match(r, ">= "+v)
+}
+
+// Below reports whether the current version is less than the "v",
+// it's a shortcut of `Match(r, "< "+v)`.
+func Below(r *http.Request, v string) bool {
+	return Match(r, "< "+v)
+}
+
+// Between reports whether the current version is greater than or equal to the "min"
+// and less than the "max", it's a shortcut of `Match(r, ">= "+min+", < "+max)`.
+func Between(r *http.Request, min, max string) bool {
+	return Match(r, ">= "+min+", < "+max)
+}
+
+// Constraint is a compiled version constraint, e.g. ">= 2, < 3",
+// it can be reused across requests without parsing the constraint on each call like `If` and `Match` do.
+// See `Compile`.
+type Constraint struct {
+	raw      string
+	comparer Comparer
+	checker  Checker
+}
+
+// Compile parses the "constraint" through the `DefaultComparer` and returns a reusable `Constraint`.
+// It returns an error if the "constraint" cannot be parsed.
+//
+// Example:
+//
+//	var v2 = versioning.MustCompile(">= 2, < 3")
+//
+//	func handler(w http.ResponseWriter, r *http.Request) {
+//		if v2.Matches(r) {
+//			// [...]
+//		}
+//	}
+func Compile(constraint string) (Constraint, error) {
+	comparer := DefaultComparer
+	checker, err := comparer.ParseConstraint(constraint)
+	if err != nil {
+		return Constraint{}, fmt.Errorf("versioning: invalid version constraint %q: %w", constraint, err)
+	}
+
+	return Constraint{raw: constraint, comparer: comparer, checker: checker}, nil
+}
+
+// MustCompile same as `Compile` but it panics if the "constraint" cannot be parsed.
+func MustCompile(constraint string) Constraint {
+	c, err := Compile(constraint)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// String returns the constraint as it was compiled.
+func (c Constraint) String() string {
+	return c.raw
+}
+
+// MatchesVersion reports whether the "v" satisfies the constraint.
+// An invalid version does not match.
+func (c Constraint) MatchesVersion(v string) bool {
+	if c.checker == nil {
+		return false
+	}
+
+	ver, err := c.comparer.ParseVersion(normalizeVersion(v))
+	if err != nil {
+		return false
+	}
+
+	return c.checker.Check(ver)
+}
+
+// Matches reports whether the current version satisfies the constraint, see `GetVersion`.
+// A request without a version does not match.
+func (c Constraint) Matches(r *http.Request) bool {
+	v, ok := GetVersionOK(r)
+	if !ok {
+		return false
+	}
+
+	return c.MatchesVersion(v)
+}
+
 // Map is a map of version to handler.
 // A handler per version or constraint, the key can be something like ">1, <=2" or just "1".
+// A handler can be a `Matcher` too, e.g. a matcher per major version of matchers per minor version,
+// the nested matcher reads the resolved version of the outer one through `GetVersion`,
+// or the version as it was requested by the client through the `Extractor(GetRequestedVersion)` option.
+//
+// When more than one keys match the requested version, the precedence is:
+// exact versions (e.g. "2.5") are checked first, then the constraints with
+// the most conditions (e.g. ">= 2, < 3" before ">= 2") and, on equality, the keys are compared alphabetically.
 type Map map[string]http.Handler
 
-// NewMatcher creates a single handler which decides what handler
+// Versions returns the version constraints of the "versions", excluding the `NotFound` one,
+// by their matching precedence (see `Map`). Invalid version constraints are excluded too.
+// Useful to list the supported versions, e.g. on a not found handler or a discovery endpoint.
+func Versions(versions Map) []string {
+	var constraintsHandlers []*constraintsHandler
+	for v := range versions {
+		if v == NotFound {
+			continue
+		}
+
+		ch, err := newConstraintsHandler(DefaultComparer, v, nil)
+		if err != nil {
+			continue
+		}
+
+		constraintsHandlers = append(constraintsHandlers, ch)
+	}
+
+	return constraintsKeys(constraintsHandlers)
+}
+
+// constraintsKeys returns the keys of the constraints handlers by their precedence.
+func constraintsKeys(constraintsHandlers []*constraintsHandler) []string {
+	sortConstraints(constraintsHandlers)
+
+	keys := make([]string, len(constraintsHandlers))
+	for i, ch := range constraintsHandlers {
+		keys[i] = ch.key
+	}
+
+	return keys
+}
+
+// MatcherOption sets an option to the `Matcher` created by `NewMatcher`.
+type MatcherOption func(*matcherOptions)
+
+type matcherOptions struct {
+	extractor             VersionExtractor
+	sources               []VersionSource
+	defaultVersion        string
+	responseVersionHeader string
+	matchedHeader         string
+	cacheSize             int
+	comparer              Comparer
+	onMatch               func(r *http.Request, matched string)
+	onNotFound            func(r *http.Request, requested string)
+	ignorePrerelease      bool
+	strict                bool
+	majorRanges           bool
+	conflictPolicy        ConflictPolicy
+	unknownStatusCode     int
+}
+
+// Extractor is a `MatcherOption` which sets the function
+// that reads the requested version, e.g. from a cookie or the URL path.
+// Defaults to `GetVersion`, which also adds the version headers to the "Vary" response header.
+func Extractor(extractor VersionExtractor) MatcherOption {
+	return func(opts *matcherOptions) {
+		if extractor != nil {
+			opts.extractor = extractor
+		}
+	}
+}
+
+// Sources is a `MatcherOption` which reads the requested version from the given sources by order,
+// instead of the `VersionSources`, e.g. to prefer the url query over the headers:
+//
+//	versioning.Sources(versioning.ExtractorSource(versioning.FromQuery("api-version")), versioning.VersionFromAcceptVersion)
+//
+// Unlike the `Extractor` option, the version headers are still added to the "Vary" response header.
+func Sources(sources ...VersionSource) MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.sources = sources
+	}
+}
+
+// DefaultVersion is a `MatcherOption` which sets the version
+// of the requests that do not contain a version, e.g. "1.0" for backwards compatibility.
+// A request of an unsupported version is still handled by the not found handler.
+func DefaultVersion(version string) MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.defaultVersion = version
+	}
+}
+
+// DefaultToLatest is a `MatcherOption` which routes the requests
+// without a version to the highest registered version, as if they requested the `Latest`.
+// It's a shortcut of `DefaultVersion(Latest)`.
+func DefaultToLatest() MatcherOption {
+	return DefaultVersion(Latest)
+}
+
+// ResponseVersionHeader is a `MatcherOption` which sets the response header name
+// of the matched version. Defaults to "X-API-Version", an empty name disables the header.
+func ResponseVersionHeader(name string) MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.responseVersionHeader = name
+	}
+}
+
+// MatchedHeader is a `MatcherOption` which sends the key of the `Map` that matched the requested version,
+// e.g. "X-API-Matched: >= 2, < 3", through the response header of the given "name".
+// Useful for debugging why a request landed on a particular handler.
+// It's disabled by default, the innermost matcher of nested matchers sends its own key.
+func MatchedHeader(name string) MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.matchedHeader = name
+	}
+}
+
+// VersionComparer is a `MatcherOption` which sets the `Comparer`
+// of the requested versions and the keys of the `Map`, e.g. for date versions like "2023-10-01".
+// Defaults to the `DefaultComparer`.
+func VersionComparer(comparer Comparer) MatcherOption {
+	return func(opts *matcherOptions) {
+		if comparer != nil {
+			opts.comparer = comparer
+		}
+	}
+}
+
+// IgnorePrerelease is a `MatcherOption` which matches the pre-release versions
+// as their stable ones too, e.g. the "2.0.0-rc.1" and "2.0.0-beta" are matched as "2.0.0"
+// unless a "2.0.0-rc.1" or "2.0.0-beta" key is registered.
+// By default a pre-release version does not satisfy the constraints of stable versions,
+// e.g. "2.0.0-beta" does not match neither "2.0.0" nor ">= 1, < 3".
+// The build metadata, e.g. "2.0.0+build.5", are always ignored.
+//
+// The handler receives the requested version, including its pre-release, through the `GetVersion`.
+func IgnorePrerelease() MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.ignorePrerelease = true
+	}
+}
+
+// MajorRanges is a `MatcherOption` which treats the keys of a bare major version as the range of that major version,
+// e.g. the "1" key as ">= 1, < 2", so the "1.0", "1.5" and "1.9.3" versions match it.
+// By default a version key is an exact version, i.e "1", "1.0" and "1.0.0" match the "1", "1.0" and "1.0.0" versions only.
+// The keys with a minor or a patch version, e.g. "1.0", are not affected. It's applied to the semver keys only.
+func MajorRanges() MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.majorRanges = true
+	}
+}
+
+// Strict is a `MatcherOption` which responds with 400 Bad Request, instead of executing the not found handler,
+// when the requested version cannot be parsed, e.g. "Accept-Version: banana".
+// The well-formed but unsupported versions are still handled by the not found handler.
+func Strict() MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.strict = true
+	}
+}
+
+// invalidVersionHandler responds to the versions that cannot be parsed, see `Strict`.
+var invalidVersionHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, fmt.Sprintf("invalid version %q", GetRequestedVersion(r)), http.StatusBadRequest)
+})
+
+// RejectUnknown is a `MatcherOption` which responds with the given "statusCode", defaults to 403 Forbidden,
+// instead of executing the not found handler, when the requested version is valid but it's not registered,
+// i.e the keys of the `Map` are an allowlist of versions. A request without a version and the invalid versions
+// are still handled by the not found handler (see `Strict` too).
+func RejectUnknown(statusCode int) MatcherOption {
+	return func(opts *matcherOptions) {
+		if statusCode == 0 {
+			statusCode = http.StatusForbidden
+		}
+
+		opts.unknownStatusCode = statusCode
+	}
+}
+
+// unknownVersionHandler returns the handler of the valid but not registered versions, see `RejectUnknown`.
+func unknownVersionHandler(statusCode int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, fmt.Sprintf("version %q is not allowed", GetVersion(r)), statusCode)
+	})
+}
+
+// ConflictPolicy defines the version of a request which sends both the "Accept-Version" and the "Accept" headers
+// but their versions disagree, e.g. "Accept-Version: 1.0" and "Accept: application/json; version=2.0".
+// See the `VersionConflict` matcher option.
+type ConflictPolicy uint8
+
+const (
+	// PreferAcceptVersion selects the version of the "Accept-Version" header, the default policy.
+	PreferAcceptVersion ConflictPolicy = iota
+	// PreferAccept selects the version of the "Accept" header.
+	PreferAccept
+	// RejectConflict responds with 400 Bad Request.
+	RejectConflict
+)
+
+// VersionConflict is a `MatcherOption` which sets the `ConflictPolicy` of the disagreeing
+// "Accept-Version" and "Accept" headers. It applies when the version is read by the default extractor,
+// a version stored to the request context (see `WithVersion`) still takes precedence over both of them.
+// Defaults to the `PreferAcceptVersion`.
+func VersionConflict(policy ConflictPolicy) MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.conflictPolicy = policy
+	}
+}
+
+// conflictingVersionsHandler responds to the disagreeing "Accept-Version" and "Accept" headers, see `RejectConflict`.
+var conflictingVersionsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	acceptVersion, _ := VersionFromAcceptVersion(r)
+	accept, _ := VersionFromAccept(r)
+	http.Error(w, fmt.Sprintf("conflicting versions %q of the %s header and %q of the %s header",
+		acceptVersion, acceptVersionHeaderKey(), accept, AcceptHeaderKey), http.StatusBadRequest)
+})
+
+// headerVersions returns the versions of the "Accept-Version" and the "Accept" headers
+// and reports whether both of them are sent but they disagree, e.g. "2" and "2.0" agree.
+// A version of the request context wins both of them.
+func (m *Matcher) headerVersions(r *http.Request) (acceptVersion, accept string, conflict bool) {
+	if _, ok := r.Context().Value(contextKey{}).(string); ok {
+		return "", "", false
+	}
+
+	acceptVersion, hasAcceptVersion := VersionFromAcceptVersion(r)
+	accept, hasAccept := VersionFromAccept(r)
+	if !hasAcceptVersion || !hasAccept {
+		return "", "", false
+	}
+
+	return acceptVersion, accept, !m.sameVersion(acceptVersion, accept)
+}
+
+// sameVersion reports whether the "a" and "b" are the same version, i.e "v2" and "2.0.0" are.
+func (m *Matcher) sameVersion(a, b string) bool {
+	a, b = normalizeVersion(a), normalizeVersion(b)
+	if a == b {
+		return true
+	}
+
+	va, err := m.opts.comparer.ParseVersion(a)
+	if err != nil {
+		return false
+	}
+
+	vb, err := m.opts.comparer.ParseVersion(b)
+	if err != nil {
+		return false
+	}
+
+	return va.String() == vb.String()
+}
+
+// OnMatch is a `MatcherOption` which registers a function that is called
+// when a registered version constraint, the "matched" one (e.g. ">= 2, < 3"), matches the requested version,
+// right before its handler is executed. Useful for metrics, e.g. requests per version.
+func OnMatch(fn func(r *http.Request, matched string)) MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.onMatch = fn
+	}
+}
+
+// OnNotFound is a `MatcherOption` which registers a function that is called
+// when no registered version constraint matches the requested version,
+// right before the not found handler is executed.
+// The "requested" is the version as it was extracted from the request (see `GetRequestedVersion`),
+// the `NotFound` if the request does not contain a version.
+func OnNotFound(fn func(r *http.Request, requested string)) MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.onNotFound = fn
+	}
+}
+
+// DefaultCacheSize is the default maximum number of requested versions
+// that a matcher remembers the matched handler of, see `CacheSize`.
+const DefaultCacheSize = 256
+
+// CacheSize is a `MatcherOption` which sets the maximum number of requested versions,
+// e.g. "2.0" or "2.0, 1.0;q=0.5", that the matcher remembers the matched handler of,
+// so the repeated ones skip the version parsing and the constraints checks.
+// When the cache is full it is emptied. Defaults to `DefaultCacheSize`, zero disables the cache.
+func CacheSize(n int) MatcherOption {
+	return func(opts *matcherOptions) {
+		opts.cacheSize = n
+	}
+}
+
+// NewMatcher creates a single handler, a `Matcher`, which decides what handler
 // should be executed based on the requested version.
+// It panics if a key of the "versions" is not a valid version constraint,
+// use the `NewMatcherErr` to handle that case instead.
+//
+// When the client requests a range of versions instead of a single version,
+// e.g. "Accept-Version: >= 1", ">= 1, < 3" or ">=1 <3", the highest version that satisfies
+// both the requested range and a registered version constraint is selected,
+// e.g. "2.0.0" for the ">= 1, < 2" and ">= 2, < 3" registered constraints.
+// The selected version is stored to the request context, so `GetVersion` reports it to the handler.
+// The candidate versions are the ones mentioned by the requested range and the registered semver constraints.
+// Alternatives separated by "||", e.g. "1.0 || >=2 <3", are tried in order.
 //
 // Use the `NewGroup` if you want to add many routes under a specific version.
 //
-// See `Map` and `NewGroup` too.
-func NewMatcher(versions Map) http.Handler {
-	constraintsHandlers, notFoundHandler := buildConstraints(versions)
+// See `Map`, `NewGroup` and `MatcherOption` too.
+func NewMatcher(versions Map, options ...MatcherOption) *Matcher {
+	matcher, err := NewMatcherErr(versions, options...)
+	if err != nil {
+		panic(err)
+	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		versionString := GetVersion(r)
-		if versionString == NotFound {
-			notFoundHandler.ServeHTTP(w, r)
-			return
-		}
+	return matcher
+}
 
-		ver, err := version.NewVersion(versionString)
-		if err != nil {
-			notFoundHandler.ServeHTTP(w, r)
-			return
+// Only returns a handler which executes the "handler" only if the requested version
+// matches the "constraint", e.g. ">= 2", otherwise it executes the `NotFoundHandler`.
+// It's a shortcut of `NewMatcher(Map{constraint: handler})` for a single version endpoint,
+// so the "X-API-Version" response header is sent on success too.
+// It panics if the "constraint" is not a valid version constraint.
+func Only(constraint string, handler http.Handler) http.Handler {
+	return NewMatcher(Map{constraint: handler})
+}
+
+// NewMatcherErr same as `NewMatcher` but it returns an error
+// instead of panicking when a key of the "versions" is not a valid version constraint.
+func NewMatcherErr(versions Map, options ...MatcherOption) (*Matcher, error) {
+	m, err := newMatcher(versions, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// NewMatcherFunc same as `NewMatcher` but it accepts the version not found handler
+// as an explicit argument, instead of the `NotFound` key of the "versions".
+// A nil "notFound" fallbacks to the `NotFound` key or the `NotFoundHandler`.
+func NewMatcherFunc(versions Map, notFound http.Handler, options ...MatcherOption) *Matcher {
+	m, err := newMatcher(versions, options)
+	if err != nil {
+		panic(err)
+	}
+
+	if notFound != nil {
+		m.SetNotFound(notFound)
+	}
+
+	return m
+}
+
+// NewNegotiatingMatcher same as `NewMatcher`.
+//
+// Deprecated: use NewMatcher, which negotiates ranges too.
+func NewNegotiatingMatcher(versions Map, options ...MatcherOption) *Matcher {
+	return NewMatcher(versions, options...)
+}
+
+// FallThrough executes the handler of the next lower registered version of the "m" matcher,
+// so a handler can delegate to a previous version's handler, e.g. for a sub-resource it didn't change.
+// It should be called by a handler executed by the "m" matcher, multiple versions can fall through in a row.
+// The versions are compared by their upper limit, like the `Latest` does,
+// and the request's version (see `GetVersion`) is the highest one of the lower registered version.
+// The not found handler is executed instead if there is no lower version.
+//
+// Example:
+//
+//	var matcher *versioning.Matcher
+//	matcher = versioning.NewMatcher(versioning.Map{
+//		"1.0": v1Handler,
+//		">= 2, < 3": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//			versioning.FallThrough(w, r, matcher)
+//		}),
+//	})
+func FallThrough(w http.ResponseWriter, r *http.Request, m *Matcher) {
+	current, _ := r.Context().Value(matchedContextKey{}).(*constraintsHandler)
+
+	var next *constraintsHandler
+	m.mu.RLock()
+	for i, ch := range m.descending {
+		if ch == current && i < len(m.descending)-1 {
+			next = m.descending[i+1]
+			break
 		}
+	}
+	m.mu.RUnlock()
+
+	if next == nil {
+		m.serveNotFound(w, r)
+		return
+	}
+
+	if ver := representative(next.constraints); ver != nil {
+		r = r.WithContext(WithVersion(r.Context(), ver.String()))
+	}
+
+	m.serve(w, r, next)
+}
+
+// Middleware same as `NewMatcher` but instead of executing the handler of the requested version
+// it stores the version to the request context and calls the "next" handler, e.g. a router of that version.
+// If the handler of the matched version is a `Deprecated` one then its deprecation headers are sent too
+// (and the "next" is not called after its sunset date, see `BlockAfterSunset`),
+// the handler itself is never executed and can be nil.
+// The not found handler is executed when no version matches, as usual.
+//
+// Example:
+//
+//	versioning.Middleware(versioning.Map{
+//		"1.0":       versioning.Deprecated(nil, versioning.DefaultDeprecationOptions),
+//		">= 2, < 3": nil,
+//	})(router)
+func Middleware(versions Map, options ...MatcherOption) func(http.Handler) http.Handler {
+	m, err := newMatcher(versions, options)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ch, r := m.match(w, r)
+			if ch == nil {
+				m.serveNotFound(w, r)
+				return
+			}
 
-		for _, ch := range constraintsHandlers {
-			if ch.constraints.Check(ver) {
-				w.Header().Set("X-API-Version", ver.String())
+			if m.rejects(ch) {
 				ch.handler.ServeHTTP(w, r)
 				return
 			}
+
+			if d, ok := ch.handler.(*deprecatedHandler); ok && !d.handle(w, r) {
+				return
+			}
+
+			// the matched version is still available to the "next" handler, i.e its `GetVersionInfo`.
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), matchedContextKey{}, ch)))
+		})
+	}
+}
+
+// Matcher is an `http.Handler` which executes the handler of the requested version.
+// It is created by the `NewMatcher`, `NewMatcherErr` and `NewMatcherFunc` functions.
+//
+// It's safe for concurrent use, its `Add`, `SetNotFound` and `Reload` methods can be called while it serves requests.
+type Matcher struct {
+	opts matcherOptions
+
+	// varyHeaders reports whether the version is read from the request headers,
+	// so caches should know about it.
+	varyHeaders bool
+
+	// mu protects the constraints handlers and the ones that depend on them, see `Reload`.
+	mu                  sync.RWMutex
+	constraintsHandlers []*constraintsHandler
+	// majors indexes the constraints handlers by major version, nil if they cannot be indexed.
+	majors *majorIndex
+	// descending are the constraints handlers by their version, highest first, see `FallThrough`.
+	descending      []*constraintsHandler
+	latest          *constraintsHandler
+	notFoundHandler http.Handler
+	// invalidVersion is the constraints handler of the versions that cannot be parsed, nil if not `Strict`.
+	invalidVersion *constraintsHandler
+	// conflictingVersions is the constraints handler of the disagreeing version headers, nil if not `RejectConflict`.
+	conflictingVersions *constraintsHandler
+	// unknownVersion is the constraints handler of the valid but not registered versions, nil if not `RejectUnknown`.
+	unknownVersion *constraintsHandler
+
+	cache *matchCache
+}
+
+func newMatcher(versions Map, options []MatcherOption) (*Matcher, error) {
+	opts := matcherOptions{
+		responseVersionHeader: "X-API-Version",
+		cacheSize:             DefaultCacheSize,
+		comparer:              DefaultComparer,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	// the default extractor reads the versioning headers, see `extract`.
+	varyHeaders := opts.extractor == nil
+
+	constraintsHandlers, notFoundHandler, err := opts.buildConstraints(versions)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Matcher{
+		opts:            opts,
+		varyHeaders:     varyHeaders,
+		notFoundHandler: notFoundHandler,
+	}
+	if opts.strict {
+		m.invalidVersion = &constraintsHandler{handler: invalidVersionHandler}
+	}
+	if opts.conflictPolicy == RejectConflict {
+		m.conflictingVersions = &constraintsHandler{handler: conflictingVersionsHandler}
+	}
+	if opts.unknownStatusCode != 0 {
+		m.unknownVersion = &constraintsHandler{handler: unknownVersionHandler(opts.unknownStatusCode)}
+	}
+	m.setConstraints(constraintsHandlers)
+
+	return m, nil
+}
+
+// buildConstraints parses the "versions" by the comparer of the options, see `buildConstraints`.
+func (opts *matcherOptions) buildConstraints(versions Map) ([]*constraintsHandler, http.Handler, error) {
+	constraintsHandlers, notFoundHandler, err := buildConstraints(versions, opts.comparer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.majorRanges {
+		for i, ch := range constraintsHandlers {
+			constraintsHandlers[i] = majorRangeHandler(ch)
 		}
+		sortConstraints(constraintsHandlers)
+	}
 
-		// pass the not matched version so the not found handler can have knowedge about it.
-		// ctx.Values().Set(Key, versionString)
-		// or let a manual cal of GetVersion(ctx) do that instead.
-		notFoundHandler.ServeHTTP(w, r)
+	return constraintsHandlers, notFoundHandler, nil
+}
+
+// setConstraints sets the constraints handlers, sorted by their precedence,
+// and resets the ones that depend on them. The caller should hold the write lock, if the matcher is in use.
+func (m *Matcher) setConstraints(constraintsHandlers []*constraintsHandler) {
+	descending := make([]*constraintsHandler, len(constraintsHandlers))
+	copy(descending, constraintsHandlers)
+	sort.SliceStable(descending, func(i, j int) bool {
+		return compareConstraints(descending[i].constraints, descending[j].constraints) > 0
 	})
+
+	m.constraintsHandlers = constraintsHandlers
+	m.majors = newMajorIndex(constraintsHandlers)
+	m.descending = descending
+	m.latest = latestConstraint(constraintsHandlers)
+	m.cache = newMatchCache(m.opts.cacheSize)
+}
+
+// Add registers the "handler" of a version constraint, e.g. ">= 3, < 4",
+// the handler of an already registered constraint is replaced.
+// The `NotFound` constraint sets the version not found handler instead.
+// It returns an error if the "constraint" is not a valid version constraint.
+func (m *Matcher) Add(constraint string, handler http.Handler) error {
+	if constraint == NotFound {
+		m.SetNotFound(handler)
+		return nil
+	}
+
+	ch, err := newConstraintsHandler(m.opts.comparer, constraint, handler)
+	if err != nil {
+		return fmt.Errorf("versioning: invalid version constraint %q: %w", constraint, err)
+	}
+
+	if m.opts.majorRanges {
+		ch = majorRangeHandler(ch)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	constraintsHandlers := make([]*constraintsHandler, 0, len(m.constraintsHandlers)+1)
+	for _, existing := range m.constraintsHandlers {
+		if existing.key != constraint {
+			constraintsHandlers = append(constraintsHandlers, existing)
+		}
+	}
+	constraintsHandlers = append(constraintsHandlers, ch)
+	sortConstraints(constraintsHandlers)
+
+	m.setConstraints(constraintsHandlers)
+	return nil
+}
+
+// Reload replaces all the registered versions with the "versions", atomically,
+// so the in-flight requests are served by either the previous or the new versions, never by a mix of them.
+// The not found handler is replaced too if the "versions" contain a `NotFound` entry.
+// It returns an error, and keeps the previous versions, if a key of the "versions" is not a valid version constraint.
+// Useful to reconfigure the versions at runtime without registering the matcher again.
+func (m *Matcher) Reload(versions Map) error {
+	constraintsHandlers, notFoundHandler, err := m.opts.buildConstraints(versions)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.setConstraints(constraintsHandlers)
+	if _, ok := versions[NotFound]; ok {
+		m.notFoundHandler = notFoundHandler
+	}
+	m.mu.Unlock()
+
+	return nil
+}
+
+// SetNotFound sets the handler which is executed when no version matches,
+// a nil "handler" resets it to the `NotFoundHandler`.
+func (m *Matcher) SetNotFound(handler http.Handler) {
+	if handler == nil {
+		handler = NotFoundHandler
+	}
+
+	m.mu.Lock()
+	m.notFoundHandler = handler
+	m.mu.Unlock()
+}
+
+// Versions returns the registered version constraints by their matching precedence (see `Map`).
+func (m *Matcher) Versions() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.versions()
+}
+
+// versions same as `Versions` but the caller should hold the lock.
+func (m *Matcher) versions() []string {
+	keys := make([]string, len(m.constraintsHandlers))
+	for i, ch := range m.constraintsHandlers {
+		keys[i] = ch.key
+	}
+
+	return keys
+}
+
+// ServeHTTP executes the handler of the requested version or the not found handler.
+func (m *Matcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ch, r := m.match(w, r)
+	if ch == nil {
+		m.serveNotFound(w, r)
+		return
+	}
+
+	m.serve(w, r, ch)
+}
+
+// serve executes the handler of the matched "ch", the `FallThrough` resumes below it.
+func (m *Matcher) serve(w http.ResponseWriter, r *http.Request, ch *constraintsHandler) {
+	r = r.WithContext(context.WithValue(r.Context(), matchedContextKey{}, ch))
+	ch.handler.ServeHTTP(w, r)
+}
+
+// serveNotFound executes the not found handler,
+// the registered versions are available to it through `GetSupportedVersions`.
+func (m *Matcher) serveNotFound(w http.ResponseWriter, r *http.Request) {
+	m.mu.RLock()
+	versions, notFoundHandler := m.versions(), m.notFoundHandler
+	m.mu.RUnlock()
+
+	r = r.WithContext(context.WithValue(r.Context(), supportedContextKey{}, versions))
+	notFoundHandler.ServeHTTP(w, r)
+}
+
+// match returns the constraints handler of the requested version or nil if not found,
+// see `resolve`. It calls the `OnMatch` and `OnNotFound` functions, if any.
+func (m *Matcher) match(w http.ResponseWriter, r *http.Request) (*constraintsHandler, *http.Request) {
+	// the lock is not held while the handlers are executed, so they can use the matcher, e.g. `FallThrough`.
+	m.mu.RLock()
+	ch, r := m.resolve(w, r)
+	m.mu.RUnlock()
+
+	m.notify(r, ch)
+	return ch, r
+}
+
+// notify calls the `OnMatch` or the `OnNotFound` function, if any, of the "ch" result of a match.
+func (m *Matcher) notify(r *http.Request, ch *constraintsHandler) {
+	if ch == nil || m.rejects(ch) {
+		if m.opts.onNotFound != nil {
+			m.opts.onNotFound(r, GetRequestedVersion(r))
+		}
+	} else if m.opts.onMatch != nil {
+		m.opts.onMatch(r, ch.key)
+	}
+}
+
+// ServeVersion same as `ServeHTTP` but it executes the handler of the given "version",
+// e.g. a version already known by an internal call, instead of extracting it from the request.
+// A missing (empty or `NotFound`) or an invalid version executes the not found handler, as usual.
+func (m *Matcher) ServeVersion(w http.ResponseWriter, r *http.Request, version string) {
+	found := version != "" && version != NotFound
+	r = withRequestedVersion(r, version, found)
+
+	m.mu.RLock()
+	ch, r := m.resolveVersion(w, r, version, found)
+	m.mu.RUnlock()
+
+	m.notify(r, ch)
+	if ch == nil {
+		m.serveNotFound(w, r)
+		return
+	}
+
+	m.serve(w, r, ch)
+}
+
+// withRequestedVersion stores the "version" to the request context, see `GetRequestedVersion`.
+// A nested matcher keeps the version requested by the client, instead of the resolved one of the outer matcher.
+// A missing, not "found", version is not stored.
+func withRequestedVersion(r *http.Request, version string, found bool) *http.Request {
+	if _, nested := r.Context().Value(requestedContextKey{}).(string); !nested && found {
+		r = r.WithContext(context.WithValue(r.Context(), requestedContextKey{}, version))
+	}
+
+	return r
+}
+
+// Resolve reports which version constraint, e.g. ">= 2, < 3", the matcher would execute for the given "version",
+// without executing its handler, useful for debugging and admin tools.
+// It follows the same rules as `ServeHTTP`, i.e the `DefaultVersion` applies to an empty version
+// and the "found" is false for a version which would execute the not found handler or would be rejected,
+// see `Strict` and `RejectUnknown`.
+func (m *Matcher) Resolve(version string) (constraint string, found bool) {
+	m.mu.RLock()
+	ch, _ := m.resolveVersion(nil, &http.Request{}, version, version != "" && version != NotFound)
+	m.mu.RUnlock()
+
+	if ch == nil || m.rejects(ch) {
+		return "", false
+	}
+
+	return ch.key, true
+}
+
+// rejects reports whether the "ch" is the handler of a rejected request, see `Strict`, `RejectConflict` and `RejectUnknown`.
+func (m *Matcher) rejects(ch *constraintsHandler) bool {
+	return ch != nil && (ch == m.invalidVersion || ch == m.conflictingVersions || ch == m.unknownVersion)
+}
+
+// resolve returns the constraints handler of the requested version or nil if not found.
+// The caller should hold the read lock.
+// The returned request contains the requested version, so the handlers
+// (and the not found one) can read it through `GetVersion` without extracting it again.
+func (m *Matcher) resolve(w http.ResponseWriter, r *http.Request) (*constraintsHandler, *http.Request) {
+	if m.varyHeaders {
+		varyVersion(w.Header(), r)
+		if m.opts.conflictPolicy != PreferAcceptVersion {
+			// the Accept header decides the response even when the Accept-Version one is present.
+			addVary(w.Header(), acceptVersionHeaderKey(), AcceptHeaderKey)
+		}
+	}
+
+	versionString, found := m.extract(r)
+	conflict := false
+	if m.varyHeaders && m.opts.conflictPolicy != PreferAcceptVersion {
+		var accept string
+		if _, accept, conflict = m.headerVersions(r); conflict && m.opts.conflictPolicy == PreferAccept {
+			versionString = accept
+		}
+	}
+
+	r = withRequestedVersion(r, versionString, found)
+	if conflict && m.conflictingVersions != nil {
+		return m.conflictingVersions, r
+	}
+
+	return m.resolveVersion(w, r, versionString, found)
+}
+
+// extract returns the requested version and reports whether the request contains one.
+// The default extractor reads the `VersionSources`, or the `Sources` option's ones, directly,
+// so a client which sends the `NotFound` as its version is not treated as a request without a version.
+func (m *Matcher) extract(r *http.Request) (string, bool) {
+	if !m.varyHeaders {
+		version := m.opts.extractor(r)
+		return version, version != "" && version != NotFound
+	}
+
+	sources := m.opts.sources
+	if sources == nil {
+		sources = VersionSources
+	}
+
+	return resolveVersion(r, sources)
+}
+
+// resolveVersion same as `resolve` but for an already extracted "versionString",
+// the "found" reports whether the request contains a version.
+// The caller should hold the read lock.
+func (m *Matcher) resolveVersion(w http.ResponseWriter, r *http.Request, versionString string, found bool) (*constraintsHandler, *http.Request) {
+	if !found && m.opts.defaultVersion != "" {
+		versionString, found = m.opts.defaultVersion, true
+	}
+
+	if !found {
+		return nil, r
+	}
+
+	if versionString == Latest && m.latest != nil {
+		if ver := representative(m.latest.constraints); ver != nil {
+			r = r.WithContext(WithVersion(r.Context(), ver.String()))
+			m.setVersionHeader(w, ver)
+		}
+
+		m.setMatchedHeader(w, m.latest)
+		return m.latest, r
+	}
+
+	result, ok := m.cache.get(versionString)
+	if !ok {
+		result = m.matchVersion(versionString)
+		m.cache.set(versionString, result)
+	}
+
+	if result.handler == nil {
+		// pass the requested version to the not found handler too.
+		r = r.WithContext(WithVersion(r.Context(), versionString))
+		if result.invalid && m.invalidVersion != nil {
+			return m.invalidVersion, r
+		}
+
+		if !result.invalid && m.unknownVersion != nil {
+			return m.unknownVersion, r
+		}
+
+		return nil, r
+	}
+
+	m.setVersionHeader(w, result.version)
+	m.setMatchedHeader(w, result.handler)
+	return result.handler, r.WithContext(WithVersion(r.Context(), result.candidate))
+}
+
+// matchResult is the result of matching a requested version to a constraints handler.
+type matchResult struct {
+	handler   *constraintsHandler // nil if not found.
+	candidate string
+	version   Version
+	// invalid reports whether none of the requested versions could be parsed.
+	invalid bool
+}
+
+// matchVersion returns the constraints handler of the "versionString".
+func (m *Matcher) matchVersion(versionString string) matchResult {
+	// alternatives of versions, e.g. "1.0 || >=2 <3", see `NotAcceptableHandler`.
+	if strings.Contains(versionString, "||") {
+		invalid := true
+		for _, alternative := range strings.Split(versionString, "||") {
+			result := m.matchVersion(strings.TrimSpace(alternative))
+			if result.handler != nil {
+				return result
+			}
+
+			invalid = invalid && result.invalid
+		}
+
+		return matchResult{invalid: invalid}
+	}
+
+	versionString = trimExactOperator(versionString)
+	if isVersionRange(versionString) {
+		if result, ok := m.negotiateVersion(versionString); ok {
+			return result
+		}
+	}
+
+	// the version may be a list of acceptable versions, e.g. "2.0, 1.0;q=0.5",
+	// try them by preference order.
+	candidates := parseVersionList(versionString)
+	invalid := len(candidates) > 0
+	for _, candidate := range candidates {
+		candidate = normalizeVersion(candidate)
+		ver, err := m.opts.comparer.ParseVersion(candidate)
+		if err != nil {
+			continue
+		}
+		invalid = false
+
+		var stable Version // the version without its pre-release, if ignored.
+		if semver, ok := ver.(*version.Version); ok && m.opts.ignorePrerelease && semver.Prerelease() != "" {
+			stable = semver.Core()
+		}
+
+		for _, ch := range m.candidates(ver) {
+			if ch.checker.Check(ver) || (stable != nil && ch.checker.Check(stable)) {
+				return matchResult{handler: ch, candidate: candidate, version: ver}
+			}
+		}
+	}
+
+	return matchResult{invalid: invalid}
+}
+
+// candidates returns the constraints handlers which can match the "ver", by their precedence.
+func (m *Matcher) candidates(ver Version) []*constraintsHandler {
+	if semver, ok := ver.(*version.Version); ok && m.majors != nil {
+		return m.majors.candidates(semver.Segments()[0])
+	}
+
+	return m.constraintsHandlers
+}
+
+// negotiateVersion returns the constraints handler of the highest version
+// that the requested "versionRange" and a registered constraint accept.
+// It reports false if the "versionRange" is not a range of versions, e.g. "2.0" or "= 2.0",
+// or if the versions are not compared by the `Semver` comparer.
+func (m *Matcher) negotiateVersion(versionRange string) (matchResult, bool) {
+	if _, ok := m.opts.comparer.(semverComparer); !ok {
+		return matchResult{}, false
+	}
+
+	requested, err := version.NewConstraint(normalizeVersionRange(versionRange))
+	if err != nil {
+		return matchResult{}, false
+	}
+
+	if (&constraintsHandler{constraints: requested}).isExact() {
+		return matchResult{}, false
+	}
+
+	var result matchResult
+	for _, candidate := range negotiationCandidates(requested, m.constraintsHandlers) {
+		if !requested.Check(candidate) {
+			continue
+		}
+
+		if result.version != nil && !candidate.GreaterThan(result.version.(*version.Version)) {
+			continue
+		}
+
+		for _, ch := range m.constraintsHandlers {
+			if ch.constraints != nil && ch.constraints.Check(candidate) {
+				result = matchResult{handler: ch, candidate: candidate.String(), version: candidate}
+				break
+			}
+		}
+	}
+
+	return result, true
+}
+
+// setVersionHeader sends the matched version to the client, if enabled.
+// An already sent version, i.e by an outer matcher of nested matchers, is not overwritten.
+// A nil "w" sends nothing, see `Resolve`.
+func (m *Matcher) setVersionHeader(w http.ResponseWriter, ver Version) {
+	if w == nil {
+		return
+	}
+
+	if name := m.opts.responseVersionHeader; name != "" && w.Header().Get(name) == "" {
+		w.Header().Set(name, ver.String())
+	}
+}
+
+// setMatchedHeader sends the key of the matched constraints handler to the client, if enabled, see `MatchedHeader`.
+func (m *Matcher) setMatchedHeader(w http.ResponseWriter, ch *constraintsHandler) {
+	if name := m.opts.matchedHeader; name != "" && w != nil {
+		w.Header().Set(name, ch.key)
+	}
+}
+
+// matchCache is a size-limited, safe for concurrent use, cache of the requested versions and their match result.
+// A nil *matchCache is a disabled cache.
+type matchCache struct {
+	mu      sync.RWMutex
+	size    int
+	entries map[string]matchResult
+}
+
+func newMatchCache(size int) *matchCache {
+	if size <= 0 {
+		return nil
+	}
+
+	return &matchCache{
+		size:    size,
+		entries: make(map[string]matchResult, size),
+	}
+}
+
+func (c *matchCache) get(versionString string) (matchResult, bool) {
+	if c == nil {
+		return matchResult{}, false
+	}
+
+	c.mu.RLock()
+	result, ok := c.entries[versionString]
+	c.mu.RUnlock()
+	return result, ok
+}
+
+func (c *matchCache) set(versionString string, result matchResult) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= c.size {
+		// the requested versions are client input, so keep the memory bounded.
+		c.entries = make(map[string]matchResult, c.size)
+	}
+	c.entries[versionString] = result
+	c.mu.Unlock()
 }
 
 type constraintsHandler struct {
+	key     string
+	checker Checker
+	// constraints are the semver constraints of the checker,
+	// nil if the key is not parsed by the `Semver` comparer.
 	constraints version.Constraints
 	handler     http.Handler
+	// info is the information of the version, nil if not registered through `WithInfo`.
+	info *VersionInfo
 }
 
-func buildConstraints(versionsHandler Map) (constraintsHandlers []*constraintsHandler, notfoundHandler http.Handler) {
+func newConstraintsHandler(comparer Comparer, key string, handler http.Handler) (*constraintsHandler, error) {
+	constraint := key
+	if _, ok := comparer.(semverComparer); ok {
+		if wildcard, ok := wildcardConstraint(key); ok {
+			constraint = wildcard
+		}
+	}
+
+	checker, err := comparer.ParseConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := &constraintsHandler{
+		key:     key,
+		checker: checker,
+	}
+	ch.handler, ch.info = unwrapInfo(handler)
+
+	if constraints, ok := checker.(semverConstraints); ok {
+		ch.constraints = version.Constraints(constraints)
+	}
+
+	return ch, nil
+}
+
+// isExact reports whether all of the constraints are equality checks, e.g. "1.0" or "= 1.0".
+func (ch *constraintsHandler) isExact() bool {
+	for _, c := range ch.constraints {
+		if op, _ := splitConstraint(c); op != "" && op != "=" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortConstraints sorts the constraints handlers by their precedence, see `Map`.
+func sortConstraints(constraintsHandlers []*constraintsHandler) {
+	sort.Slice(constraintsHandlers, func(i, j int) bool {
+		a, b := constraintsHandlers[i], constraintsHandlers[j]
+
+		if aExact, bExact := a.isExact(), b.isExact(); aExact != bExact {
+			return aExact
+		}
+
+		if len(a.constraints) != len(b.constraints) {
+			return len(a.constraints) > len(b.constraints)
+		}
+
+		return a.key < b.key
+	})
+}
+
+func buildConstraints(versionsHandler Map, comparer Comparer) (constraintsHandlers []*constraintsHandler, notfoundHandler http.Handler, err error) {
 	for v, h := range versionsHandler {
 		if v == NotFound {
 			notfoundHandler = h
 			continue
 		}
 
-		constraints, err := version.NewConstraint(v)
-		if err != nil {
-			panic(err)
+		ch, parseErr := newConstraintsHandler(comparer, v, h)
+		if parseErr != nil {
+			return nil, nil, fmt.Errorf("versioning: invalid version constraint %q: %w", v, parseErr)
 		}
 
-		constraintsHandlers = append(constraintsHandlers, &constraintsHandler{
-			constraints: constraints,
-			handler:     h,
-		})
+		constraintsHandlers = append(constraintsHandlers, ch)
 	}
 
+	sortConstraints(constraintsHandlers)
+
 	if notfoundHandler == nil {
 		notfoundHandler = NotFoundHandler
 	}
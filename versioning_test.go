@@ -2,13 +2,18 @@ package versioning_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kataras/versioning"
 )
@@ -37,6 +42,223 @@ func TestIf(t *testing.T) {
 	}
 }
 
+func TestIfNormalizesVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected bool
+	}{
+		{"v1", true},
+		{"V1.5", true},
+		{" 1.0 ", true},
+		{"vabc", false},
+		{"v", false},
+	}
+
+	for _, tt := range tests {
+		if got := versioning.If(tt.version, ">= 1, < 2"); tt.expected != got {
+			t.Fatalf("[%s]: expected %v but got %v", tt.version, tt.expected, got)
+		}
+	}
+}
+
+func TestIfErr(t *testing.T) {
+	tests := []struct {
+		version  string
+		is       string
+		expected bool
+		err      string // empty for no error.
+	}{
+		{"1.0", ">= 1", true, ""},
+		{"v2", ">= 1, < 2", false, ""},
+		{"banana", ">= 1", false, `versioning: invalid version "banana"`},
+		{"1.0", "=> 1", false, `versioning: invalid version constraint "=> 1"`},
+	}
+
+	for _, tt := range tests {
+		got, err := versioning.IfErr(tt.version, tt.is)
+		if tt.expected != got {
+			t.Fatalf("[%s] [%s]: expected %v but got %v", tt.version, tt.is, tt.expected, got)
+		}
+
+		if tt.err == "" && err != nil {
+			t.Fatalf("[%s] [%s]: unexpected error: %v", tt.version, tt.is, err)
+		}
+		if tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)) {
+			t.Fatalf("[%s] [%s]: expected error %q but got %v", tt.version, tt.is, tt.err, err)
+		}
+	}
+}
+
+func TestMatchErr(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	// no version is not an error.
+	if ok, err := versioning.MatchErr(r, ">= 1"); ok || err != nil {
+		t.Fatalf("expected no match and no error but got %v, %v", ok, err)
+	}
+	if _, err := versioning.MatchErr(r, "=> 1"); err == nil {
+		t.Fatalf("expected an invalid version constraint error")
+	}
+
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "2.1")
+	if ok, err := versioning.MatchErr(r, ">= 2"); !ok || err != nil {
+		t.Fatalf("expected a match and no error but got %v, %v", ok, err)
+	}
+
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "two")
+	if _, err := versioning.MatchErr(r, ">= 2"); err == nil {
+		t.Fatalf("expected an invalid version error")
+	}
+}
+
+func TestCompile(t *testing.T) {
+	constraint, err := versioning.Compile(">= 2, < 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := ">= 2, < 3", constraint.String(); expected != got {
+		t.Fatalf("expected constraint %q but got %q", expected, got)
+	}
+
+	for v, expected := range map[string]bool{"2": true, "v2.5.1": true, "3.0": false, "1.9": false, "banana": false} {
+		if got := constraint.MatchesVersion(v); expected != got {
+			t.Fatalf("[%s] expected %v but got %v", v, expected, got)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if constraint.Matches(r) {
+		t.Fatalf("expected a request without a version to not match")
+	}
+
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "2.1")
+	if !constraint.Matches(r) {
+		t.Fatalf("expected the request version to match")
+	}
+
+	if _, err := versioning.Compile("=> 1"); err == nil {
+		t.Fatalf("expected an invalid version constraint error")
+	}
+
+	if (versioning.Constraint{}).MatchesVersion("1.0") {
+		t.Fatalf("expected the zero constraint to not match")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected MustCompile to panic on an invalid version constraint")
+		}
+	}()
+	versioning.MustCompile("=> 1")
+}
+
+func TestMatchAnyAll(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "2.3")
+
+	tests := []struct {
+		name     string
+		got      bool
+		expected bool
+	}{
+		{"MatchAny one", versioning.MatchAny(r, "1.0", ">= 2, < 3"), true},
+		{"MatchAny none", versioning.MatchAny(r, "1.0", ">= 3"), false},
+		{"MatchAny empty", versioning.MatchAny(r), false},
+		{"MatchAny invalid", versioning.MatchAny(r, "=> 1", ">= 2"), true},
+		{"MatchAll all", versioning.MatchAll(r, ">= 2", "< 3"), true},
+		{"MatchAll one", versioning.MatchAll(r, ">= 2", "!= 2.3"), false},
+		{"MatchAll empty", versioning.MatchAll(r), true},
+		{"MatchAll invalid", versioning.MatchAll(r, "=> 1", ">= 2"), false},
+	}
+
+	for _, tt := range tests {
+		if tt.expected != tt.got {
+			t.Fatalf("[%s] expected %v but got %v", tt.name, tt.expected, tt.got)
+		}
+	}
+
+	if _, err := versioning.MatchAnyErr(r, "=> 1", ">= 2"); err == nil {
+		t.Fatalf("expected an invalid version constraint error")
+	}
+	if _, err := versioning.MatchAllErr(r, ">= 2", "=> 1"); err == nil {
+		t.Fatalf("expected an invalid version constraint error")
+	}
+	if ok, err := versioning.MatchAllErr(r, ">= 2", "< 3"); !ok || err != nil {
+		t.Fatalf("expected a match and no error but got %v, %v", ok, err)
+	}
+
+	// no version is not an error but the constraints are still validated.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	if ok, err := versioning.MatchAnyErr(r, ">= 1"); ok || err != nil {
+		t.Fatalf("expected no match and no error but got %v, %v", ok, err)
+	}
+	if ok := versioning.MatchAll(r); ok {
+		t.Fatalf("expected a request without a version to not match")
+	}
+	if _, err := versioning.MatchAllErr(r, "=> 1"); err == nil {
+		t.Fatalf("expected an invalid version constraint error")
+	}
+
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "two")
+	if _, err := versioning.MatchAnyErr(r, ">= 2"); err == nil {
+		t.Fatalf("expected an invalid version error")
+	}
+}
+
+func TestMatchBounds(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "2.1")
+
+	tests := []struct {
+		name     string
+		got      bool
+		expected bool
+	}{
+		{"AtLeast 2.0", versioning.AtLeast(r, "2.0"), true},
+		{"AtLeast 2.1", versioning.AtLeast(r, "2.1"), true},
+		{"AtLeast 3", versioning.AtLeast(r, "3"), false},
+		{"Below 3", versioning.Below(r, "3"), true},
+		{"Below 2.1", versioning.Below(r, "2.1"), false},
+		{"Between 2, 3", versioning.Between(r, "2", "3"), true},
+		{"Between 1, 2.1", versioning.Between(r, "1", "2.1"), false},
+		{"AtLeast invalid", versioning.AtLeast(r, "banana"), false},
+	}
+
+	for _, tt := range tests {
+		if tt.expected != tt.got {
+			t.Fatalf("[%s]: expected %v but got %v", tt.name, tt.expected, tt.got)
+		}
+	}
+
+	if versioning.AtLeast(httptest.NewRequest(http.MethodGet, "/", nil), "1") {
+		t.Fatalf("expected a request without a version to not match")
+	}
+}
+
+func TestNewMatcherNormalizesVersion(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	})
+
+	expectVersion(t, matcher, "v1").
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+	expectVersion(t, matcher, "V2.5").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "2.5.0").
+		bodyEq(v2Response)
+	expectVersion(t, matcher, " 1.0 ").
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+	expectVersion(t, matcher, "vabc").
+		statusCode(http.StatusNotImplemented)
+	expectVersion(t, matcher, "V3, v2.1;q=0.5").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+}
+
 func TestNewMatcher(t *testing.T) {
 	router := http.NewServeMux()
 	router.Handle("/api/user", versioning.NewMatcher(versioning.Map{
@@ -45,42 +267,1286 @@ func TestNewMatcher(t *testing.T) {
 		versioning.NotFound: notFoundHandler,
 	}))
 
-	// middleware as usual.
-	myMiddleware := func(next http.Handler) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("X-Custom", "something")
-			next.ServeHTTP(w, r)
+	// middleware as usual.
+	myMiddleware := func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Custom", "something")
+			next.ServeHTTP(w, r)
+		}
+	}
+	myVersions := versioning.Map{
+		"1.0": sendHandler(v10Response),
+	}
+
+	router.Handle("/api/user/with_middleware", myMiddleware(versioning.NewMatcher(myVersions)))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "1")).
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "2.0")).
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "2.1")).
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "2.9.9")).
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+
+	// middleware as usual.
+	expect(t, http.MethodGet, srv.URL+"/api/user/with_middleware", withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
+		statusCode(http.StatusOK).
+		bodyEq(v10Response).headerEq("X-Custom", "something")
+	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "3.0")).
+		statusCode(http.StatusNotFound).
+		bodyEq("Not Found\n")
+}
+
+func TestOnly(t *testing.T) {
+	handler := versioning.Only(">= 2", sendHandler(v2Response))
+
+	expectVersion(t, handler, "2.1").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "2.1.0").
+		bodyEq(v2Response)
+	expectVersion(t, handler, "1.0").
+		statusCode(http.StatusNotImplemented).
+		headerEq("X-API-Version", "").
+		bodyEq("version not found")
+	expectVersion(t, handler, "").
+		statusCode(http.StatusNotImplemented)
+}
+
+func TestNewMatcherErr(t *testing.T) {
+	_, err := versioning.NewMatcherErr(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, <= ": sendHandler(v2Response),
+	})
+	if err == nil {
+		t.Fatalf("expected an error for an invalid version constraint")
+	}
+	if expected, got := `">= 2, <= "`, err.Error(); !strings.Contains(got, expected) {
+		t.Fatalf("expected error to contain the invalid key %s but got: %s", expected, got)
+	}
+
+	matcher, err := versioning.NewMatcherErr(versioning.Map{
+		"1.0": sendHandler(v10Response),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testHandler(t, matcher, http.MethodGet, "/").statusCode(http.StatusNotImplemented)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected NewMatcher to panic on invalid version constraint")
+		}
+	}()
+	versioning.NewMatcher(versioning.Map{"invalid": sendHandler(v10Response)})
+}
+
+func TestVersions(t *testing.T) {
+	versions := versioning.Map{
+		">= 2":              sendHandler(""),
+		">= 2, < 3":         sendHandler(""),
+		"1.0":               sendHandler(""),
+		"invalid":           sendHandler(""),
+		versioning.NotFound: notFoundHandler,
+	}
+
+	expected := []string{"1.0", ">= 2, < 3", ">= 2"}
+	for i := 0; i < 10; i++ {
+		if got := versioning.Versions(versions); !reflect.DeepEqual(expected, got) {
+			t.Fatalf("expected versions: %q but got %q", expected, got)
+		}
+	}
+
+	if got := versioning.Versions(nil); len(got) != 0 {
+		t.Fatalf("expected no versions but got %q", got)
+	}
+}
+
+func TestNewMatcherPrecedence(t *testing.T) {
+	versions := versioning.Map{
+		">= 2":      sendHandler(">= 2"),
+		">= 2, < 3": sendHandler(">= 2, < 3"),
+		"2.5":       sendHandler("2.5"),
+		"> 1":       sendHandler("> 1"),
+	}
+
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"2.5", "2.5"},
+		{"2.6", ">= 2, < 3"},
+		{"3.0", "> 1"},
+		{"1.5", "> 1"},
+	}
+
+	// map iteration order is random, build it many times to ensure that the winner is stable.
+	for i := 0; i < 20; i++ {
+		matcher := versioning.NewMatcher(versions)
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(versioning.AcceptVersionHeaderKey, tt.version)
+			matcher.ServeHTTP(w, r)
+
+			if got := w.Body.String(); tt.expected != got {
+				t.Fatalf("[%s]: expected to be handled by '%s' but got '%s'", tt.version, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestNewMatcherLatest(t *testing.T) {
+	versions := versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	}
+
+	matcher := versioning.NewMatcher(versions)
+	expectVersion(t, matcher, versioning.Latest).
+		statusCode(http.StatusOK).
+		bodyEq(v2Response).
+		headerEq("X-API-Version", "2.0.0")
+	expectVersion(t, matcher, "").
+		statusCode(http.StatusNotImplemented)
+
+	versions[">= 4"] = sendHandler("v4+ handler")
+	versions["3.5"] = sendHandler("v3.5 handler")
+	matcher = versioning.NewMatcher(versions, versioning.DefaultToLatest())
+	expectVersion(t, matcher, versioning.Latest).
+		statusCode(http.StatusOK).
+		bodyEq("v4+ handler")
+	expectVersion(t, matcher, "").
+		statusCode(http.StatusOK).
+		bodyEq("v4+ handler").
+		headerEq("X-API-Version", "4.0.0")
+	expectVersion(t, matcher, "1.0").
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+}
+
+func TestNewMatcherDefaultVersion(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	}, versioning.DefaultVersion("1.0"))
+
+	expectVersion(t, matcher, "").
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+	expectVersion(t, matcher, "2.5").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	// explicitly requested but unsupported versions are not replaced by the default one.
+	expectVersion(t, matcher, "3.0").
+		statusCode(http.StatusNotImplemented)
+	expectVersion(t, matcher, "banana").
+		statusCode(http.StatusNotImplemented)
+	// the NotFound sent by a client is an explicitly requested version too.
+	expectVersion(t, matcher, versioning.NotFound).
+		statusCode(http.StatusNotImplemented)
+}
+
+func TestNewMatcherVersionList(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	})
+
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"2.0, 1.0;q=0.5", v2Response},
+		{"1.0;q=0.5, 2.0", v2Response},
+		{"1.0;q=0.9, 2.0;q=0.4", v10Response},
+		{"3.0, 1.0;q=0.5", v10Response},
+		{"banana, 2.1;q=0.1", v2Response},
+		{"2.0;q=0, 1.0;q=0.2", v10Response},
+	}
+
+	for _, tt := range tests {
+		expectVersion(t, matcher, tt.version).
+			statusCode(http.StatusOK).
+			bodyEq(tt.expected)
+	}
+
+	expectVersion(t, matcher, "3.0, 4.0;q=0.5").
+		statusCode(http.StatusNotImplemented)
+	expectVersion(t, matcher, "1.0;q=0").
+		statusCode(http.StatusNotImplemented)
+}
+
+func TestNewMatcherVary(t *testing.T) {
+	withVary := func(vary string, next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Vary", vary)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	versions := versioning.Map{
+		"1.0": sendHandler(v10Response),
+	}
+
+	router := http.NewServeMux()
+	router.Handle("/", versioning.NewMatcher(versions))
+	router.Handle("/origin", withVary("Origin", versioning.NewMatcher(versions)))
+	router.Handle("/all", withVary("*", versioning.NewMatcher(versions)))
+	router.Handle("/path/", versioning.NewMatcher(versions, versioning.Extractor(versioning.FromPath("/path"))))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	expect(t, http.MethodGet, srv.URL, withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
+		statusCode(http.StatusOK).
+		headerValuesEq("Vary", "Accept-Version")
+	expect(t, http.MethodGet, srv.URL, withHeader(versioning.AcceptHeaderKey, "application/json; version=1.0")).
+		statusCode(http.StatusOK).
+		headerValuesEq("Vary", "Accept-Version", "Accept")
+	expect(t, http.MethodGet, srv.URL+"/origin", withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
+		statusCode(http.StatusOK).
+		headerValuesEq("Vary", "Origin", "Accept-Version")
+	expect(t, http.MethodGet, srv.URL+"/all", withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
+		statusCode(http.StatusOK).
+		headerValuesEq("Vary", "*")
+	// not found responses vary too.
+	expect(t, http.MethodGet, srv.URL, withHeader(versioning.AcceptVersionHeaderKey, "3.0")).
+		statusCode(http.StatusNotImplemented).
+		headerValuesEq("Vary", "Accept-Version")
+	// custom extractors do not read the headers.
+	expect(t, http.MethodGet, srv.URL+"/path/v1", withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
+		statusCode(http.StatusOK).
+		headerValuesEq("Vary")
+
+	// deprecated handlers do not duplicate the values.
+	deprecated := versioning.NewMatcher(versioning.DeprecatedMap(versions, []string{"1.0"}, versioning.DefaultDeprecationOptions))
+	expectVersion(t, deprecated, "1.0").
+		statusCode(http.StatusOK).
+		headerValuesEq("Vary", "Accept-Version")
+}
+
+func TestNewMatcherFunc(t *testing.T) {
+	matcher := versioning.NewMatcherFunc(versioning.Map{
+		"1.0":               sendHandler(v10Response),
+		versioning.NotFound: versioning.NotFoundHandler,
+	}, notFoundHandler)
+
+	expectVersion(t, matcher, "1.0").
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+	expectVersion(t, matcher, "2.0").
+		statusCode(http.StatusNotFound).
+		bodyEq("Not Found\n")
+
+	// a nil not found handler fallbacks to the map's one.
+	matcher = versioning.NewMatcherFunc(versioning.Map{
+		"1.0":               sendHandler(v10Response),
+		versioning.NotFound: notFoundHandler,
+	}, nil)
+	expectVersion(t, matcher, "2.0").
+		statusCode(http.StatusNotFound)
+}
+
+func TestMiddleware(t *testing.T) {
+	writeVersion := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versioning.GetVersion(r)))
+	})
+
+	mw := versioning.Middleware(versioning.Map{
+		"1.0":               versioning.Deprecated(nil, versioning.DefaultDeprecationOptions),
+		">= 2, < 3":         nil,
+		versioning.NotFound: notFoundHandler,
+	}, versioning.Extractor(versioning.FromQuery("v")))
+
+	router := http.NewServeMux()
+	router.Handle("/", mw(writeVersion))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	expect(t, http.MethodGet, srv.URL+"?v=1.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "1.0.0").
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		bodyEq("1.0")
+	expect(t, http.MethodGet, srv.URL+"?v=2.1").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "2.1.0").
+		headerEq("X-API-Warn", "").
+		bodyEq("2.1")
+	expect(t, http.MethodGet, srv.URL+"?v=3").
+		statusCode(http.StatusNotFound).
+		bodyEq("Not Found\n")
+}
+
+func TestNewMatcherExtractor(t *testing.T) {
+	fromCookie := func(r *http.Request) string {
+		cookie, err := r.Cookie("api-version")
+		if err != nil {
+			return versioning.NotFound
+		}
+
+		return cookie.Value
+	}
+
+	router := http.NewServeMux()
+	router.Handle("/api/user", versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	}, versioning.Extractor(fromCookie)))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader("Cookie", "api-version=1.0")).
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader("Cookie", "api-version=2.5")).
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	// the default header is not consulted when a custom extractor is set.
+	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
+		statusCode(http.StatusNotImplemented).
+		bodyEq("version not found")
+
+	// an empty version of a custom extractor is a missing version too.
+	empty := versioning.Extractor(func(r *http.Request) string { return "" })
+	expectVersion(t, versioning.NewMatcher(versioning.Map{"1.0": sendHandler(v10Response)}, empty, versioning.DefaultVersion("1.0")), "").
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+	expectVersion(t, versioning.NewMatcher(versioning.Map{"1.0": sendHandler(v10Response)}, empty, versioning.Strict()), "").
+		statusCode(http.StatusNotImplemented).
+		bodyEq("version not found")
+}
+
+func TestNewMatcherStoresVersion(t *testing.T) {
+	writeVersion := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versioning.GetVersion(r)))
+	})
+
+	matcher := versioning.NewMatcher(versioning.Map{
+		">= 1, < 2":         writeVersion,
+		versioning.NotFound: writeVersion,
+	}, versioning.Extractor(versioning.FromPath("/api")))
+
+	testHandler(t, matcher, http.MethodGet, "/api/v1.5/users").
+		statusCode(http.StatusOK).
+		bodyEq("1.5")
+	// the not found handler knows the requested version too.
+	testHandler(t, matcher, http.MethodGet, "/api/v3/users").
+		statusCode(http.StatusOK).
+		bodyEq("3")
+	testHandler(t, matcher, http.MethodGet, "/api/users").
+		statusCode(http.StatusOK).
+		bodyEq(versioning.NotFound)
+}
+
+func TestNewMatcherResponseVersionHeader(t *testing.T) {
+	versions := versioning.Map{
+		"1.0": sendHandler(v10Response),
+	}
+
+	expectVersion(t, versioning.NewMatcher(versions), "1").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "1.0.0")
+
+	expectVersion(t, versioning.NewMatcher(versions, versioning.ResponseVersionHeader("X-Served-Version")), "1").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "").
+		headerEq("X-Served-Version", "1.0.0")
+
+	expectVersion(t, versioning.NewMatcher(versions, versioning.ResponseVersionHeader("")), "1").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "").
+		bodyEq(v10Response)
+}
+
+func TestNewMatcherRequestedVersion(t *testing.T) {
+	writeRequestedVersion := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versioning.GetRequestedVersion(r)))
+	})
+
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":               writeRequestedVersion,
+		versioning.NotFound: writeRequestedVersion,
+	}, versioning.DefaultVersion("1.0"))
+
+	expectVersion(t, matcher, "3.0").bodyEq("3.0")
+	expectVersion(t, matcher, "banana").bodyEq("banana")
+	expectVersion(t, matcher, "v1").bodyEq("v1")
+	// not requested, served by the default version.
+	expectVersion(t, matcher, "").bodyEq(versioning.NotFound)
+}
+
+func TestNewMatcherCache(t *testing.T) {
+	writeVersion := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versioning.GetVersion(r)))
+	}
+
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":               http.HandlerFunc(writeVersion),
+		">= 2, < 3":         http.HandlerFunc(writeVersion),
+		versioning.NotFound: http.HandlerFunc(writeVersion),
+	}, versioning.CacheSize(2))
+
+	// repeat them, so the cached (and the evicted) results are served too.
+	for i := 0; i < 3; i++ {
+		expectVersion(t, matcher, "v2.5").
+			statusCode(http.StatusOK).
+			headerEq("X-API-Version", "2.5.0").
+			bodyEq("2.5")
+		expectVersion(t, matcher, "1").
+			statusCode(http.StatusOK).
+			headerEq("X-API-Version", "1.0.0").
+			bodyEq("1")
+		expectVersion(t, matcher, "3.0").
+			statusCode(http.StatusOK).
+			headerEq("X-API-Version", "").
+			bodyEq("3.0")
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0": sendHandler(v10Response),
+	})
+
+	expectVersion(t, matcher, "2.5").statusCode(http.StatusNotImplemented)
+
+	if err := matcher.Add(">= 2, < 3", sendHandler(v2Response)); err != nil {
+		t.Fatal(err)
+	}
+	if err := matcher.Add("banana", sendHandler("")); err == nil {
+		t.Fatalf("expected an invalid version constraint error")
+	}
+	// replace the handler of an existing constraint.
+	if err := matcher.Add("1.0", sendHandler("1.0 replaced")); err != nil {
+		t.Fatal(err)
+	}
+	if err := matcher.Add(versioning.NotFound, notFoundHandler); err != nil {
+		t.Fatal(err)
+	}
+
+	expectVersion(t, matcher, "2.5").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	expectVersion(t, matcher, "1").
+		statusCode(http.StatusOK).
+		bodyEq("1.0 replaced")
+	expectVersion(t, matcher, versioning.Latest).
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "2.0.0")
+	expectVersion(t, matcher, "3").statusCode(http.StatusNotFound)
+
+	if expected, got := []string{"1.0", ">= 2, < 3"}, matcher.Versions(); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected versions %v but got %v", expected, got)
+	}
+
+	matcher.SetNotFound(nil)
+	expectVersion(t, matcher, "3").statusCode(http.StatusNotImplemented)
+}
+
+func TestNewNegotiatingMatcher(t *testing.T) {
+	matcher := versioning.NewNegotiatingMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	})
+
+	expectVersion(t, matcher, ">=1 <2").
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+	expectVersion(t, matcher, ">= 1").
+		bodyEq(v2Response)
+	expectVersion(t, matcher, "3.0").
+		statusCode(http.StatusNotImplemented)
+}
+
+func TestNewMatcherNegotiation(t *testing.T) {
+	writeVersion := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versioning.GetVersion(r)))
+	}
+
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       http.HandlerFunc(writeVersion),
+		"~> 1.2":    http.HandlerFunc(writeVersion),
+		">= 2, < 3": http.HandlerFunc(writeVersion),
+	})
+
+	tests := []struct {
+		requested string
+		version   string // empty for not found.
+	}{
+		{">= 1", "2.0.0"},
+		{">= 1, < 2", "1.2.0"},
+		{"<= 1.5", "1.5.0"},
+		{"< 1.2", "1.0.0"},
+		{"> 2.5", "2.5.1"},
+		{">= 3", ""},
+		// separated by spaces.
+		{">=1 <2", "1.2.0"},
+		{">= 1 < 1.5", "1.2.0"},
+		{"> 2.5 , <= 2.7", "2.7.0"},
+		// not ranges.
+		{"1.4", "1.4"},
+		{"3.0, 1.0;q=0.5", "1.0"},
+		{"3.0, 1.0", "1.0"},
+		// exact constraints.
+		{"= 1.0", "1.0"},
+		{"=2.5", "2.5"},
+		{"= 3.0", ""},
+	}
+
+	for _, tt := range tests {
+		resp := expectVersion(t, matcher, tt.requested)
+		if tt.version == "" {
+			resp.statusCode(http.StatusNotImplemented)
+			continue
+		}
+
+		resp.statusCode(http.StatusOK).bodyEq(tt.version)
+	}
+}
+
+func TestNewMatcherVersionRange(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	})
+
+	expectVersion(t, matcher, ">=1 <2").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "1.0.0").
+		bodyEq(v10Response)
+	expectVersion(t, matcher, ">= 1").
+		headerEq("X-API-Version", "2.0.0").
+		bodyEq(v2Response)
+	// not satisfied by any registered version.
+	expectVersion(t, matcher, ">=3 <4").
+		statusCode(http.StatusNotImplemented)
+	// a malformed range.
+	expectVersion(t, matcher, ">= 1 <").
+		statusCode(http.StatusNotImplemented)
+	expectVersion(t, versioning.NewMatcher(versioning.Map{"1.0": sendHandler(v10Response)}, versioning.Strict()), ">= banana").
+		statusCode(http.StatusBadRequest)
+
+	// the ranges are negotiated by the semver comparer only.
+	expectVersion(t, versioning.NewMatcher(versioning.Map{"1": sendHandler(v10Response)}, versioning.VersionComparer(intComparer{})), ">= 1").
+		statusCode(http.StatusNotImplemented)
+}
+
+func TestNewMatcherHooks(t *testing.T) {
+	var matched, notFound []string
+
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	}, versioning.OnMatch(func(r *http.Request, version string) {
+		matched = append(matched, version)
+	}), versioning.OnNotFound(func(r *http.Request, requested string) {
+		notFound = append(notFound, requested)
+	}))
+
+	expectVersion(t, matcher, "1").statusCode(http.StatusOK)
+	expectVersion(t, matcher, "2.5").statusCode(http.StatusOK)
+	expectVersion(t, matcher, versioning.Latest).statusCode(http.StatusOK)
+	expectVersion(t, matcher, "3").statusCode(http.StatusNotImplemented)
+	expectVersion(t, matcher, "").statusCode(http.StatusNotImplemented)
+
+	if expected := []string{"1.0", ">= 2, < 3", ">= 2, < 3"}; !reflect.DeepEqual(expected, matched) {
+		t.Fatalf("expected matched versions %v but got %v", expected, matched)
+	}
+	if expected := []string{"3", versioning.NotFound}; !reflect.DeepEqual(expected, notFound) {
+		t.Fatalf("expected not found versions %v but got %v", expected, notFound)
+	}
+}
+
+func TestNewMatcherPrerelease(t *testing.T) {
+	writeVersion := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versioning.GetVersion(r)))
+	}
+
+	versions := versioning.Map{
+		"1.0":          http.HandlerFunc(writeVersion),
+		">= 2, < 3":    http.HandlerFunc(writeVersion),
+		"3.0.0-beta.2": http.HandlerFunc(writeVersion),
+	}
+
+	tests := []struct {
+		version          string
+		expected         string // empty for not found.
+		ignorePrerelease string
+	}{
+		{"2.0.0-beta", "", "2.0.0-beta"},
+		{"2.1.0-rc.1", "", "2.1.0-rc.1"},
+		{"1.0.0-rc1", "", "1.0.0-rc1"},
+		{"2.0.0+build.5", "2.0.0+build.5", "2.0.0+build.5"},
+		{"2.0.0-rc.1+build.5", "", "2.0.0-rc.1+build.5"},
+		// exact pre-release keys match the same pre-release only.
+		{"3.0.0-beta.2", "3.0.0-beta.2", "3.0.0-beta.2"},
+		{"3.0.0-beta.1", "", ""},
+	}
+
+	matcher := versioning.NewMatcher(versions)
+	ignoringMatcher := versioning.NewMatcher(versions, versioning.IgnorePrerelease())
+
+	for _, tt := range tests {
+		for handler, expected := range map[http.Handler]string{matcher: tt.expected, ignoringMatcher: tt.ignorePrerelease} {
+			resp := expectVersion(t, handler, tt.version)
+			if expected == "" {
+				resp.statusCode(http.StatusNotImplemented)
+				continue
+			}
+
+			resp.statusCode(http.StatusOK).
+				headerEq("X-API-Version", expected).
+				bodyEq(expected)
+		}
+	}
+}
+
+func TestFallThrough(t *testing.T) {
+	var matcher *versioning.Matcher
+	fallThrough := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versioning.GetVersion(r) + " -> "))
+		versioning.FallThrough(w, r, matcher)
+	})
+
+	matcher = versioning.NewMatcher(versioning.Map{
+		"1.0": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(versioning.GetVersion(r)))
+		}),
+		">= 2, < 3":         fallThrough,
+		">= 3":              fallThrough,
+		versioning.NotFound: sendHandler("not found"),
+	})
+
+	expectVersion(t, matcher, "3.5").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "3.5.0").
+		bodyEq("3.5 -> 2.0.0 -> 1.0.0")
+	expectVersion(t, matcher, "2").
+		bodyEq("2 -> 1.0.0")
+
+	// the lowest version falls through to the not found handler.
+	lowest := versioning.NewMatcher(versioning.Map{
+		"1.0":               fallThrough,
+		versioning.NotFound: sendHandler("not found"),
+	})
+	matcher = lowest
+	expectVersion(t, lowest, "1").bodyEq("1 -> not found")
+}
+
+func TestNewMatcherSources(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	}, versioning.Sources(versioning.ExtractorSource(versioning.FromQuery("api-version")), versioning.VersionFromAcceptVersion))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/?api-version=2.0", nil)
+	req.Header.Set(versioning.AcceptVersionHeaderKey, "1.0")
+	matcher.ServeHTTP(w, req)
+
+	(&testie{t: t, resp: w.Result()}).
+		statusCode(http.StatusOK).
+		headerValuesEq("Vary", versioning.AcceptVersionHeaderKey).
+		bodyEq(v2Response)
+
+	expectVersion(t, matcher, "1.0").
+		statusCode(http.StatusOK).
+		bodyEq(v10Response)
+}
+
+func TestNewMatcherMajorIndex(t *testing.T) {
+	keys := []string{
+		"1.0", "1.2.3", "= 2.1", ">= 1, < 2", "< 2.1", "< 3.0.0", "<= 3", "< 0.5",
+		"~> 2.2", "~> 3", "~> 4.1.2", "> 4.9", ">= 5, != 6", "!= 7", "3.0.0-beta.2", "< 4.0.0-rc.1", "> 1, < 0",
+	}
+
+	var matched string
+	versions := make(versioning.Map)
+	for _, key := range keys {
+		versions[key] = sendHandler(key)
+	}
+	matcher := versioning.NewMatcher(versions, versioning.CacheSize(0), versioning.OnMatch(func(r *http.Request, key string) {
+		matched = key
+	}))
+
+	requested := []string{
+		"0.1", "0.9", "1", "1.2.3", "1.9.9", "2", "2.0.5", "2.1", "2.2", "2.9", "3", "3.0.0-beta.2", "3.5",
+		"4", "4.0.0-beta", "4.1.2", "4.1.9", "4.2", "4.9", "4.9.1", "5", "6", "7", "8.1", "2000",
+	}
+
+	for _, v := range requested {
+		expected := ""
+		for _, key := range matcher.Versions() {
+			if versioning.If(v, key) {
+				expected = key
+				break
+			}
+		}
+
+		matched = ""
+		expectVersion(t, matcher, v)
+		if expected != matched {
+			t.Fatalf("[%s]: expected to match %q but matched %q", v, expected, matched)
+		}
+	}
+}
+
+func TestNewMatcherNested(t *testing.T) {
+	writeVersions := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s: %s (%s)", name, versioning.GetVersion(r), versioning.GetRequestedVersion(r))
+		})
+	}
+
+	v2 := versioning.NewMatcher(versioning.Map{
+		">= 2.0, < 2.1": writeVersions("2.0"),
+		">= 2.1, < 3":   writeVersions("2.1+"),
+	})
+
+	matcher := versioning.NewMatcher(versioning.Map{
+		">= 1, < 2":         writeVersions("1"),
+		">= 2, < 3":         v2,
+		versioning.NotFound: writeVersions("not found"),
+	})
+
+	expectVersion(t, matcher, "v2.1.5").
+		statusCode(http.StatusOK).
+		headerValuesEq("X-API-Version", "2.1.5").
+		headerValuesEq("Vary", versioning.AcceptVersionHeaderKey).
+		bodyEq("2.1+: 2.1.5 (v2.1.5)")
+	expectVersion(t, matcher, "2").
+		statusCode(http.StatusOK).
+		headerValuesEq("X-API-Version", "2.0.0").
+		bodyEq("2.0: 2 (2)")
+	// the outer matcher resolves the latest version, the inner one keeps it.
+	expectVersion(t, matcher, versioning.Latest).
+		statusCode(http.StatusOK).
+		headerValuesEq("X-API-Version", "2.0.0").
+		bodyEq("2.0: 2.0.0 (latest)")
+	expectVersion(t, matcher, "1.5").
+		statusCode(http.StatusOK).
+		bodyEq("1: 1.5 (1.5)")
+	expectVersion(t, matcher, "3").
+		statusCode(http.StatusOK).
+		bodyEq("not found: 3 (3)")
+}
+
+func TestNewMatcherMatchedHeader(t *testing.T) {
+	versions := versioning.Map{
+		"2.5":       sendHandler("2.5"),
+		">= 2, < 3": sendHandler(v2Response),
+		">= 3":      sendHandler("3+"),
+	}
+	matcher := versioning.NewMatcher(versions, versioning.MatchedHeader("X-API-Matched"))
+
+	expectVersion(t, matcher, "2.1").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Version", "2.1.0").
+		headerEq("X-API-Matched", ">= 2, < 3").
+		bodyEq(v2Response)
+	expectVersion(t, matcher, "2.5").
+		headerEq("X-API-Matched", "2.5")
+	expectVersion(t, matcher, versioning.Latest).
+		headerEq("X-API-Matched", ">= 3").
+		bodyEq("3+")
+	expectVersion(t, matcher, "1.0").
+		statusCode(http.StatusNotImplemented).
+		headerEq("X-API-Matched", "")
+
+	// disabled by default.
+	expectVersion(t, versioning.NewMatcher(versions), "2.1").
+		headerEq("X-API-Matched", "")
+
+	// the innermost matcher sends its own key.
+	nested := versioning.NewMatcher(versioning.Map{
+		">= 2": versioning.NewMatcher(versions, versioning.MatchedHeader("X-API-Matched")),
+	}, versioning.MatchedHeader("X-API-Matched"))
+	expectVersion(t, nested, "3.1").
+		headerValuesEq("X-API-Matched", ">= 3")
+}
+
+func TestNewMatcherMajorRanges(t *testing.T) {
+	tests := []struct {
+		key, requested string
+		exact, ranged  bool // expected match without and with the MajorRanges option.
+	}{
+		{"1", "1", true, true},
+		{"1", "1.0", true, true},
+		{"1", "1.0.0", true, true},
+		{"1", "1.5", false, true},
+		{"1", "v1.9.3", false, true},
+		{"1", "2.0", false, false},
+		{"1", "0.9", false, false},
+		{"v1", "1.5", false, true},
+		{"1.0", "1", true, true},
+		{"1.0", "1.0.0", true, true},
+		{"1.0", "1.5", false, false},
+		{"1.0.0", "1.0", true, true},
+		{"1.0.0", "1.0.1", false, false},
+	}
+
+	for _, tt := range tests {
+		versions := versioning.Map{tt.key: sendHandler(v10Response)}
+
+		for _, mode := range []struct {
+			name     string
+			matcher  *versioning.Matcher
+			expected bool
+		}{
+			{"exact", versioning.NewMatcher(versions), tt.exact},
+			{"ranged", versioning.NewMatcher(versions, versioning.MajorRanges()), tt.ranged},
+		} {
+			expectedStatusCode := http.StatusNotImplemented
+			if mode.expected {
+				expectedStatusCode = http.StatusOK
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(versioning.AcceptVersionHeaderKey, tt.requested)
+			mode.matcher.ServeHTTP(w, r)
+
+			if got := w.Code; expectedStatusCode != got {
+				t.Fatalf("[%s] key %q, version %q: expected status code %d but got %d", mode.name, tt.key, tt.requested, expectedStatusCode, got)
+			}
+		}
+	}
+
+	// an exact version of the same major version takes precedence, the key is kept as registered.
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1":   sendHandler(v10Response),
+		"1.5": sendHandler("1.5"),
+	}, versioning.MajorRanges(), versioning.MatchedHeader("X-API-Matched"))
+	expectVersion(t, matcher, "1.5").
+		bodyEq("1.5")
+	expectVersion(t, matcher, "1.6").
+		headerEq("X-API-Matched", "1").
+		bodyEq(v10Response)
+
+	if err := matcher.Add("2", sendHandler(v2Response)); err != nil {
+		t.Fatal(err)
+	}
+	expectVersion(t, matcher, "2.3").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	expectVersion(t, matcher, versioning.Latest).
+		bodyEq(v2Response)
+}
+
+func TestNewMatcherVersionConflict(t *testing.T) {
+	versions := versioning.Map{
+		"1.0": sendHandler(v10Response),
+		"2.0": sendHandler(v2Response),
+	}
+
+	serve := func(h http.Handler, acceptVersion, accept string) *testie {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if acceptVersion != "" {
+			r.Header.Set(versioning.AcceptVersionHeaderKey, acceptVersion)
+		}
+		if accept != "" {
+			r.Header.Set(versioning.AcceptHeaderKey, accept)
+		}
+		h.ServeHTTP(w, r)
+		return &testie{t: t, resp: w.Result()}
+	}
+
+	tests := []struct {
+		name     string
+		policy   versioning.ConflictPolicy
+		expected string // the body of the conflicting headers.
+	}{
+		{"PreferAcceptVersion", versioning.PreferAcceptVersion, v10Response},
+		{"PreferAccept", versioning.PreferAccept, v2Response},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher := versioning.NewMatcher(versions, versioning.VersionConflict(tt.policy))
+
+			vary := []string{"Accept-Version"}
+			if tt.policy != versioning.PreferAcceptVersion {
+				vary = append(vary, "Accept")
+			}
+
+			serve(matcher, "1.0", "application/json; version=2.0").
+				statusCode(http.StatusOK).
+				headerValuesEq("Vary", vary...).
+				bodyEq(tt.expected)
+			// no conflict.
+			serve(matcher, "v2", "application/json; version=2.0").
+				bodyEq(v2Response)
+			serve(matcher, "", "application/json; version=2.0").
+				bodyEq(v2Response)
+			serve(matcher, "1.0", "application/json").
+				bodyEq(v10Response)
+		})
+	}
+
+	// the default policy.
+	serve(versioning.NewMatcher(versions), "1.0", "application/vnd.api.v2+json").
+		bodyEq(v10Response)
+
+	var notFound []string
+	reject := versioning.NewMatcher(versions, versioning.VersionConflict(versioning.RejectConflict), versioning.OnNotFound(func(r *http.Request, requested string) {
+		notFound = append(notFound, requested)
+	}))
+	serve(reject, "1.0", "application/json; version=2.0").
+		statusCode(http.StatusBadRequest).
+		headerValuesEq("Vary", "Accept-Version", "Accept").
+		bodyEq("conflicting versions \"1.0\" of the Accept-Version header and \"2.0\" of the Accept header\n")
+	serve(reject, "2.0", "application/vnd.api.v2+json").
+		statusCode(http.StatusOK).
+		headerValuesEq("Vary", "Accept-Version", "Accept").
+		bodyEq(v2Response)
+	if expected := []string{"1.0"}; !reflect.DeepEqual(expected, notFound) {
+		t.Fatalf("expected not found versions %v but got %v", expected, notFound)
+	}
+
+	// the middleware does not call the next handler.
+	middleware := versioning.Middleware(versions, versioning.VersionConflict(versioning.RejectConflict))(sendHandler("next"))
+	serve(middleware, "1.0", "application/json; version=2.0").
+		statusCode(http.StatusBadRequest)
+}
+
+func TestNewMatcherRejectUnknown(t *testing.T) {
+	versions := versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	}
+
+	var notFound []string
+	matcher := versioning.NewMatcher(versions, versioning.RejectUnknown(0), versioning.OnNotFound(func(r *http.Request, requested string) {
+		notFound = append(notFound, requested)
+	}))
+
+	expectVersion(t, matcher, "3.0").
+		statusCode(http.StatusForbidden).
+		bodyEq("version \"3.0\" is not allowed\n")
+	expectVersion(t, matcher, "2.1").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	// malformed and missing versions keep the not found handler.
+	expectVersion(t, matcher, "banana").
+		statusCode(http.StatusNotImplemented).
+		bodyEq("version not found")
+	expectVersion(t, matcher, "").
+		statusCode(http.StatusNotImplemented)
+
+	if expected := []string{"3.0", "banana", versioning.NotFound}; !reflect.DeepEqual(expected, notFound) {
+		t.Fatalf("expected not found versions %v but got %v", expected, notFound)
+	}
+
+	// along with the strict option.
+	strict := versioning.NewMatcher(versions, versioning.RejectUnknown(http.StatusGone), versioning.Strict())
+	expectVersion(t, strict, "3.0").
+		statusCode(http.StatusGone)
+	expectVersion(t, strict, "banana").
+		statusCode(http.StatusBadRequest)
+
+	// the middleware does not call the next handler.
+	middleware := versioning.Middleware(versions, versioning.RejectUnknown(0))(sendHandler("next"))
+	expectVersion(t, middleware, "3.0").
+		statusCode(http.StatusForbidden)
+	expectVersion(t, middleware, "1.0").
+		bodyEq("next")
+}
+
+func TestMatcherResolve(t *testing.T) {
+	var served bool
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0": sendHandler(v10Response),
+		">= 2, < 3": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = true
+		}),
+	}, versioning.DefaultVersion("1.0"))
+
+	tests := []struct {
+		version    string
+		constraint string
+		found      bool
+	}{
+		{"2.1", ">= 2, < 3", true},
+		{"1.0", "1.0", true},
+		{"", "1.0", true},
+		{versioning.Latest, ">= 2, < 3", true},
+		{"3.0", "", false},
+		{"invalid", "", false},
+	}
+
+	for _, tt := range tests {
+		constraint, found := matcher.Resolve(tt.version)
+		if constraint != tt.constraint || found != tt.found {
+			t.Fatalf("[%s] expected %q, %v but got %q, %v", tt.version, tt.constraint, tt.found, constraint, found)
+		}
+	}
+
+	if served {
+		t.Fatalf("expected no handler to be executed")
+	}
+
+	rejecting := versioning.NewMatcher(versioning.Map{"1.0": sendHandler(v10Response)}, versioning.RejectUnknown(0))
+	if _, found := rejecting.Resolve("2.0"); found {
+		t.Fatalf("expected a rejected version to be not found")
+	}
+}
+
+func TestMatcherReload(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	})
+	matcher.SetNotFound(notFoundHandler)
+
+	if err := matcher.Reload(versioning.Map{">= 3": sendHandler("3+"), "1.0": sendHandler(v10Response)}); err != nil {
+		t.Fatal(err)
+	}
+
+	expectVersion(t, matcher, "3.1").
+		statusCode(http.StatusOK).
+		bodyEq("3+")
+	expectVersion(t, matcher, versioning.Latest).
+		bodyEq("3+")
+	// no more registered.
+	expectVersion(t, matcher, "2.1").
+		statusCode(http.StatusNotFound)
+	if expected, got := []string{"1.0", ">= 3"}, matcher.Versions(); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected versions %v but got %v", expected, got)
+	}
+
+	// an invalid version keeps the previous ones.
+	if err := matcher.Reload(versioning.Map{"=> 4": sendHandler("4")}); err == nil {
+		t.Fatalf("expected an invalid version constraint error")
+	}
+	expectVersion(t, matcher, "3.1").
+		bodyEq("3+")
+
+	// the not found handler is replaced by a NotFound entry only.
+	matcher.Reload(versioning.Map{"1.0": sendHandler(v10Response), versioning.NotFound: versioning.NotFoundHandler})
+	expectVersion(t, matcher, "3.1").
+		statusCode(http.StatusNotImplemented)
+}
+
+func TestMatcherReloadConcurrently(t *testing.T) {
+	v1 := versioning.Map{"1.0": sendHandler(v10Response), ">= 2, < 3": sendHandler(v2Response)}
+	v2 := versioning.Map{">= 2, < 3": sendHandler(v2Response), ">= 3": sendHandler("3+")}
+	matcher := versioning.NewMatcher(v1)
+
+	var (
+		readers sync.WaitGroup
+		reloads = make(chan struct{})
+		done    = make(chan struct{})
+	)
+
+	go func() {
+		defer close(reloads)
+
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			versions := v1
+			if i%2 == 0 {
+				versions = v2
+			}
+
+			if err := matcher.Reload(versions); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+
+			for j := 0; j < 200; j++ {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set(versioning.AcceptVersionHeaderKey, "2.1")
+				matcher.ServeHTTP(w, r)
+
+				// registered by both of the versions.
+				if w.Code != http.StatusOK || w.Body.String() != v2Response {
+					t.Errorf("expected the v2 handler but got %d %q", w.Code, w.Body.String())
+					return
+				}
+
+				matcher.Versions()
+			}
+		}()
+	}
+
+	readers.Wait()
+	close(done)
+	<-reloads
+}
+
+func TestMatcherServeVersion(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0": sendHandler(v10Response),
+		">= 2, < 3": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(versioning.GetVersion(r) + " " + versioning.GetRequestedVersion(r)))
+		}),
+	})
+
+	serveVersion := func(version string) *testie {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		// the header is not extracted.
+		req.Header.Set(versioning.AcceptVersionHeaderKey, "1.0")
+		matcher.ServeVersion(w, req, version)
+		resp := w.Result()
+		resp.Request = req
+		return &testie{t: t, resp: resp}
+	}
+
+	serveVersion("2.1").
+		statusCode(http.StatusOK).
+		bodyEq("2.1 2.1")
+	serveVersion("1.0").
+		bodyEq(v10Response)
+	serveVersion("3.0").
+		statusCode(http.StatusNotImplemented)
+	serveVersion("invalid").
+		statusCode(http.StatusNotImplemented)
+	serveVersion("").
+		statusCode(http.StatusNotImplemented)
+}
+
+func TestNewMatcherWildcard(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.*":   sendHandler(v10Response),
+		"2.x":   sendHandler(v2Response),
+		"2.5":   sendHandler("2.5"),
+		"3.1.X": sendHandler("3.1"),
+	}, versioning.MatchedHeader("X-API-Matched"))
+
+	tests := []struct {
+		requested string
+		body      string // empty for not found.
+	}{
+		{"2.0", v2Response},
+		{"2", v2Response},
+		{"2.9.9", v2Response},
+		{"v2.1", v2Response},
+		{"2.5", "2.5"},
+		{"1.4", v10Response},
+		{"3.1.7", "3.1"},
+		{"3.0", ""},
+		{"3.2", ""},
+		{"0.9", ""},
+	}
+
+	for _, tt := range tests {
+		resp := expectVersion(t, matcher, tt.requested)
+		if tt.body == "" {
+			resp.statusCode(http.StatusNotImplemented)
+			continue
 		}
+
+		resp.statusCode(http.StatusOK).bodyEq(tt.body)
 	}
-	myVersions := versioning.Map{
-		"1.0": sendHandler(v10Response),
+
+	// the keys are kept as registered.
+	expectVersion(t, matcher, "2.1").
+		headerEq("X-API-Matched", "2.x")
+	if expected, got := []string{"2.5", "1.*", "2.x", "3.1.X"}, matcher.Versions(); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected versions %v but got %v", expected, got)
 	}
+	expectVersion(t, matcher, versioning.Latest).
+		bodyEq("3.1")
 
-	router.Handle("/api/user/with_middleware", myMiddleware(versioning.NewMatcher(myVersions)))
+	for _, invalid := range []string{"x", "2.y", "a.x", "1.2.3.x", ".x"} {
+		if _, err := versioning.NewMatcherErr(versioning.Map{invalid: sendHandler("")}); err == nil {
+			t.Fatalf("expected an invalid version constraint error for %q", invalid)
+		}
+	}
+}
+
+func TestNewMatcherStrict(t *testing.T) {
+	versions := versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	}
+
+	var notFound []string
+	strict := versioning.NewMatcher(versions, versioning.Strict(), versioning.OnNotFound(func(r *http.Request, requested string) {
+		notFound = append(notFound, requested)
+	}))
+
+	expectVersion(t, strict, "banana").
+		statusCode(http.StatusBadRequest).
+		bodyEq("invalid version \"banana\"\n")
+	expectVersion(t, strict, "banana, apple;q=0.5").
+		statusCode(http.StatusBadRequest).
+		bodyEq("invalid version \"banana, apple;q=0.5\"\n")
+	// the version the client sent, even if it's the NotFound.
+	expectVersion(t, strict, versioning.NotFound).
+		statusCode(http.StatusBadRequest).
+		bodyEq("invalid version \"" + versioning.NotFound + "\"\n")
+	// well-formed but unsupported.
+	expectVersion(t, strict, "3.0").
+		statusCode(http.StatusNotImplemented).
+		bodyEq("version not found")
+	// a single valid version of the list is enough.
+	expectVersion(t, strict, "banana, 2.0;q=0.5").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	expectVersion(t, strict, "").
+		statusCode(http.StatusNotImplemented)
+
+	if expected := []string{"banana", "banana, apple;q=0.5", versioning.NotFound, "3.0", versioning.NotFound}; !reflect.DeepEqual(expected, notFound) {
+		t.Fatalf("expected not found versions %v but got %v", expected, notFound)
+	}
+
+	// not strict by default.
+	expectVersion(t, versioning.NewMatcher(versions), "banana").
+		statusCode(http.StatusNotImplemented)
+
+	// the middleware does not call the next handler.
+	middleware := versioning.Middleware(versions, versioning.Strict())(sendHandler("next"))
+	expectVersion(t, middleware, "banana").
+		statusCode(http.StatusBadRequest)
+}
+
+func TestNewMatcherFromQuery(t *testing.T) {
+	router := http.NewServeMux()
+	router.Handle("/api/user", versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler(v10Response),
+		">= 2, < 3": sendHandler(v2Response),
+	}, versioning.Extractor(versioning.FromQuery("api-version"))))
 
 	srv := httptest.NewServer(router)
 	defer srv.Close()
 
-	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "1")).
+	expect(t, http.MethodGet, srv.URL+"/api/user?api-version=1.0").
 		statusCode(http.StatusOK).
 		bodyEq(v10Response)
-	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "2.0")).
-		statusCode(http.StatusOK).
-		bodyEq(v2Response)
-	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "2.1")).
-		statusCode(http.StatusOK).
-		bodyEq(v2Response)
-	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "2.9.9")).
+	expect(t, http.MethodGet, srv.URL+"/api/user?api-version=v2.5").
 		statusCode(http.StatusOK).
 		bodyEq(v2Response)
-
-	// middleware as usual.
-	expect(t, http.MethodGet, srv.URL+"/api/user/with_middleware", withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
-		statusCode(http.StatusOK).
-		bodyEq(v10Response).headerEq("X-Custom", "something")
-	expect(t, http.MethodGet, srv.URL+"/api/user", withHeader(versioning.AcceptVersionHeaderKey, "3.0")).
-		statusCode(http.StatusNotFound).
-		bodyEq("Not Found\n")
+	expect(t, http.MethodGet, srv.URL+"/api/user?api-version=").
+		statusCode(http.StatusNotImplemented).
+		bodyEq("version not found")
 }
 
 func TestNewGroup(t *testing.T) {
@@ -120,6 +1586,564 @@ func TestNewGroup(t *testing.T) {
 		bodyEq("version not found")
 }
 
+func TestNewGroupMethods(t *testing.T) {
+	router := http.NewServeMux()
+
+	userAPIV1 := versioning.NewGroup("1.0").Deprecated(versioning.DefaultDeprecationOptions)
+	userAPIV1.Handle("GET /api/users", sendHandler("v1 get"))
+	userAPIV1.Handle("POST /api/users", sendHandler("v1 post"))
+	userAPIV1.Handle("/api/other", sendHandler("v1 any"))
+
+	userAPIV2 := versioning.NewGroup(">= 2, < 3")
+	userAPIV2.HandleFunc("POST /api/users", sendHandler("v2 post"))
+
+	versioning.RegisterGroups(router, versioning.NotFoundHandler, userAPIV1, userAPIV2)
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	expect(t, http.MethodGet, srv.URL+"/api/users", withHeader(versioning.AcceptVersionHeaderKey, "1")).
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		bodyEq("v1 get")
+	expect(t, http.MethodPost, srv.URL+"/api/users", withHeader(versioning.AcceptVersionHeaderKey, "1")).
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		bodyEq("v1 post")
+	expect(t, http.MethodHead, srv.URL+"/api/users", withHeader(versioning.AcceptVersionHeaderKey, "1")).
+		statusCode(http.StatusOK)
+	expect(t, http.MethodPut, srv.URL+"/api/users", withHeader(versioning.AcceptVersionHeaderKey, "1")).
+		statusCode(http.StatusMethodNotAllowed).
+		headerEq("Allow", "GET, POST")
+	expect(t, http.MethodDelete, srv.URL+"/api/other", withHeader(versioning.AcceptVersionHeaderKey, "1")).
+		statusCode(http.StatusOK).
+		bodyEq("v1 any")
+
+	expect(t, http.MethodPost, srv.URL+"/api/users", withHeader(versioning.AcceptVersionHeaderKey, "2.1")).
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", "").
+		bodyEq("v2 post")
+	expect(t, http.MethodGet, srv.URL+"/api/users", withHeader(versioning.AcceptVersionHeaderKey, "2.1")).
+		statusCode(http.StatusMethodNotAllowed).
+		headerEq("Allow", "POST")
+}
+
+func TestNewGroupOverride(t *testing.T) {
+	router := http.NewServeMux()
+
+	userAPIV1 := versioning.NewGroup("1.0")
+	userAPIV1.Handle("/api/users", sendHandler("first"))
+	userAPIV1.Handle("/api/users", sendHandler("second"))
+	userAPIV1.HandleFunc("POST /api/users/new", sendHandler("first post"))
+	userAPIV1.HandleFunc("POST /api/users/new", sendHandler("second post"))
+
+	versioning.RegisterGroups(router, nil, userAPIV1)
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	expect(t, http.MethodGet, srv.URL+"/api/users", withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
+		statusCode(http.StatusOK).
+		bodyEq("second")
+	expect(t, http.MethodPost, srv.URL+"/api/users/new", withHeader(versioning.AcceptVersionHeaderKey, "1.0")).
+		statusCode(http.StatusOK).
+		bodyEq("second post")
+}
+
+func TestNewGroupSetVersion(t *testing.T) {
+	userAPI := versioning.NewGroup("1.0")
+	userAPI.Handle("/api/users", sendHandler(v2Response))
+	if expected, got := "1.0", userAPI.Version(); expected != got {
+		t.Fatalf("expected version %q but got %q", expected, got)
+	}
+
+	// adjusted after the routes are registered.
+	if got := userAPI.SetVersion(">= 2, < 3").Version(); got != ">= 2, < 3" {
+		t.Fatalf("expected the new version but got %q", got)
+	}
+
+	routes := versioning.RegisterGroups(nil, nil, userAPI)
+	expectVersion(t, routes["/api/users"], "2.1").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	expectVersion(t, routes["/api/users"], "1.0").
+		statusCode(http.StatusNotImplemented)
+}
+
+func TestRegisterGroupsPrefix(t *testing.T) {
+	userAPIV1 := versioning.NewGroup("1.0")
+	userAPIV1.Handle("/users", sendHandler(v10Response))
+	userAPIV1.Handle("/", sendHandler("index"))
+
+	userAPIV2 := versioning.NewGroup(">= 2, < 3")
+	userAPIV2.Handle("users", sendHandler(v2Response))
+
+	tests := []struct {
+		prefix string
+		routes []string
+	}{
+		{"/api", []string{"/api/", "/api/users"}},
+		{"/api/", []string{"/api/", "/api/users"}},
+		{"api", []string{"/api/", "/api/users"}},
+		{"/", []string{"/", "/users"}},
+		{"//", []string{"/", "/users"}},
+	}
+
+	for _, tt := range tests {
+		mux := http.NewServeMux()
+		routes := versioning.RegisterGroupsPrefix(mux, tt.prefix, nil, userAPIV1, userAPIV2)
+
+		var paths []string
+		for path := range routes {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		if !reflect.DeepEqual(tt.routes, paths) {
+			t.Fatalf("[%s] expected routes %v but got %v", tt.prefix, tt.routes, paths)
+		}
+
+		for version, body := range map[string]string{"1.0": v10Response, "2.1": v2Response} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.routes[1], nil)
+			req.Header.Set(versioning.AcceptVersionHeaderKey, version)
+			mux.ServeHTTP(w, req)
+			resp := w.Result()
+			resp.Request = req
+
+			(&testie{t: t, resp: resp}).
+				statusCode(http.StatusOK).
+				bodyEq(body)
+		}
+	}
+
+	// "/users" and "users" are the same route under a prefix.
+	userAPIV1Dup := versioning.NewGroup("1.0")
+	userAPIV1Dup.Handle("users", sendHandler(v10Response))
+	if _, err := versioning.RegisterGroupsPrefixErr(nil, "/api", nil, userAPIV1, userAPIV1Dup); err == nil {
+		t.Fatalf("expected a duplicated route error")
+	}
+}
+
+func TestNewGroupUse(t *testing.T) {
+	var calls []string
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the deprecation headers are not sent yet.
+				calls = append(calls, name+":"+w.Header().Get("X-API-Warn"))
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	userAPIV1 := versioning.NewGroup("1.0").Use(middleware("first"))
+	userAPIV1.Handle("GET /api/users", sendHandler(v10Response))
+	userAPIV1.Handle("POST /api/users", sendHandler(v10Response))
+	// registered after the routes and the deprecation.
+	userAPIV1.Deprecated(versioning.DefaultDeprecationOptions).Use(middleware("second"), middleware("third"))
+
+	userAPIV2 := versioning.NewGroup(">= 2, < 3")
+	userAPIV2.Handle("/api/users", sendHandler(v2Response))
+
+	routes := versioning.RegisterGroups(nil, nil, userAPIV1, userAPIV2)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/users", nil)
+	req.Header.Set(versioning.AcceptVersionHeaderKey, "1.0")
+	routes["/api/users"].ServeHTTP(w, req)
+
+	(&testie{t: t, resp: w.Result()}).
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		bodyEq(v10Response)
+	if expected := []string{"first:", "second:", "third:"}; !reflect.DeepEqual(expected, calls) {
+		t.Fatalf("expected middleware calls %v but got %v", expected, calls)
+	}
+
+	calls = nil
+	expectVersion(t, routes["/api/users"], "2.0").
+		statusCode(http.StatusOK).
+		bodyEq(v2Response)
+	if len(calls) != 0 {
+		t.Fatalf("expected the middleware of the other group to not run but got %v", calls)
+	}
+}
+
+func TestNewGroupSuccessorVersion(t *testing.T) {
+	userAPIV1 := versioning.NewGroup("1.0").Deprecated(versioning.DefaultDeprecationOptions)
+	userAPIV1.Handle("/api/users", sendHandler(v10Response))
+	userAPIV1.Handle("/api/legacy", sendHandler(v10Response))
+
+	userAPIV2 := versioning.NewGroup(">= 2, < 3")
+	userAPIV2.Handle("/api/users", sendHandler(v2Response))
+
+	userAPIV3 := versioning.NewGroup("3.0")
+	userAPIV3.Handle("/api/users", sendHandler("3.0"))
+
+	// a deprecated group is never a successor.
+	userAPIV4 := versioning.NewGroup("4.0").Deprecated(versioning.DeprecationOptions{DeprecationInfo: "do not use"})
+	userAPIV4.Handle("/api/users", sendHandler("4.0"))
+
+	routes := versioning.RegisterGroups(nil, nil, userAPIV1, userAPIV2, userAPIV3, userAPIV4)
+
+	expectVersion(t, routes["/api/users"], "1.0").
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("X-API-Deprecation-Info", "use the 3.0.0 version instead")
+	expectVersion(t, routes["/api/users"], "2.0").
+		headerEq("X-API-Warn", "").
+		headerEq("X-API-Deprecation-Info", "")
+	// an explicit info is kept.
+	expectVersion(t, routes["/api/users"], "4.0").
+		headerEq("X-API-Deprecation-Info", "do not use")
+	// no successor on that path.
+	expectVersion(t, routes["/api/legacy"], "1.0").
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("X-API-Deprecation-Info", "")
+
+	// an older version is never a successor.
+	currentV1 := versioning.NewGroup("1.0")
+	currentV1.Handle("/api/users", sendHandler(v10Response))
+	deprecatedV2 := versioning.NewGroup(">= 2, < 3").Deprecated(versioning.DefaultDeprecationOptions)
+	deprecatedV2.Handle("/api/users", sendHandler(v2Response))
+
+	routes = versioning.RegisterGroups(nil, nil, currentV1, deprecatedV2)
+	expectVersion(t, routes["/api/users"], "2.1").
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("X-API-Deprecation-Info", "").
+		bodyEq(v2Response)
+}
+
+func TestNewGroupDeprecatedStandardHeaders(t *testing.T) {
+	userAPIV1 := versioning.NewGroup("1.0").Deprecated(versioning.DeprecationOptions{UseStandardHeaders: true})
+	userAPIV1.Handle("/api/users", sendHandler(v10Response))
+
+	userAPIV2 := versioning.NewGroup("2.0").Deprecated(versioning.DeprecationOptions{UseStandardWarning: true})
+	userAPIV2.Handle("/api/users", sendHandler(v2Response))
+
+	routes := versioning.RegisterGroups(nil, nil, userAPIV1, userAPIV2)
+
+	expectVersion(t, routes["/api/users"], "1.0").
+		statusCode(http.StatusOK).
+		headerEq("Deprecation", "true").
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		bodyEq(v10Response)
+	expectVersion(t, routes["/api/users"], "2.0").
+		statusCode(http.StatusOK).
+		headerEq("Deprecation", "").
+		headerEq("Warning", `299 - "`+versioning.DefaultDeprecationOptions.WarnMessage+`"`).
+		bodyEq(v2Response)
+}
+
+func TestNewGroupDeprecatedSuccessorLink(t *testing.T) {
+	userAPIV1 := versioning.NewGroup("1.0").Deprecated(versioning.DeprecationOptions{
+		SuccessorLink: "https://api.example.com/v2/users",
+	})
+	userAPIV1.Handle("/api/users", sendHandler(v10Response))
+
+	userAPIV2 := versioning.NewGroup(">= 2, < 3")
+	userAPIV2.Handle("/api/users", sendHandler(v2Response))
+
+	routes := versioning.RegisterGroups(nil, nil, userAPIV1, userAPIV2)
+
+	expectVersion(t, routes["/api/users"], "1.0").
+		statusCode(http.StatusOK).
+		headerEq("Link", `<https://api.example.com/v2/users>; rel="successor-version"`).
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("X-API-Deprecation-Info", "use the 2.0.0 version instead").
+		bodyEq(v10Response)
+	expectVersion(t, routes["/api/users"], "2.0").
+		headerEq("Link", "").
+		headerEq("X-API-Warn", "")
+}
+
+func TestNewGroupDeprecateRoute(t *testing.T) {
+	exportSunset := time.Date(2030, time.June, 1, 0, 0, 0, 0, time.UTC)
+	reportsSunset := time.Date(2031, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	userAPIV1 := versioning.NewGroup("1.0")
+	userAPIV1.Handle("/api/users", sendHandler(v10Response))
+	userAPIV1.Handle("/api/users/export", sendHandler(v10Response))
+	userAPIV1.Handle("/api/users/reports", sendHandler(v10Response))
+	userAPIV1.DeprecateRoute("/api/users/export", versioning.DeprecationOptions{
+		DeprecationDate:    exportSunset,
+		UseStandardHeaders: true,
+	}).DeprecateRoute("/api/users/reports", versioning.DeprecationOptions{
+		WarnMessage:        "reports are moving",
+		DeprecationDate:    reportsSunset,
+		UseStandardHeaders: true,
+	})
+
+	userAPIV2 := versioning.NewGroup("2.0")
+	userAPIV2.Handle("/api/users/export", sendHandler(v2Response))
+
+	routes := versioning.RegisterGroups(nil, nil, userAPIV1, userAPIV2)
+
+	expectVersion(t, routes["/api/users/export"], "1.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage).
+		headerEq("Sunset", exportSunset.Format(versioning.HeaderTimeFormat)).
+		headerEq("X-API-Deprecation-Info", "use the 2.0.0 version instead").
+		bodyEq(v10Response)
+	expectVersion(t, routes["/api/users/reports"], "1.0").
+		headerEq("X-API-Warn", "reports are moving").
+		headerEq("Sunset", reportsSunset.Format(versioning.HeaderTimeFormat))
+	// no override and the group is not deprecated.
+	expectVersion(t, routes["/api/users"], "1.0").
+		headerEq("X-API-Warn", "").
+		headerEq("Sunset", "")
+
+	// the override wins the group's options, the rest of the paths fall back to them.
+	userAPIV1.Deprecated(versioning.DeprecationOptions{WarnMessage: "v1 is deprecated"})
+	routes = versioning.RegisterGroups(nil, nil, userAPIV1, userAPIV2)
+
+	expectVersion(t, routes["/api/users/export"], "1.0").
+		headerEq("X-API-Warn", versioning.DefaultDeprecationOptions.WarnMessage)
+	expectVersion(t, routes["/api/users"], "1.0").
+		headerEq("X-API-Warn", "v1 is deprecated")
+
+	// a method prefix is ignored.
+	userAPIV3 := versioning.NewGroup("3.0").DeprecateRoute("GET /api/users", versioning.DeprecationOptions{WarnMessage: "v3 users are deprecated"})
+	userAPIV3.Handle("GET /api/users", sendHandler("3.0"))
+	routes = versioning.RegisterGroups(nil, nil, userAPIV3)
+
+	expectVersion(t, routes["/api/users"], "3.0").
+		statusCode(http.StatusOK).
+		headerEq("X-API-Warn", "v3 users are deprecated")
+}
+
+func TestRegisterGroupsErr(t *testing.T) {
+	first := versioning.NewGroup("1.0")
+	first.Handle("/api/users", sendHandler("first"))
+
+	second := versioning.NewGroup("1.0")
+	second.Handle("/api/users", sendHandler("second"))
+
+	// same path on a different version is fine.
+	v2 := versioning.NewGroup(">= 2, < 3")
+	v2.Handle("/api/users", sendHandler(v2Response))
+
+	router := http.NewServeMux()
+	_, err := versioning.RegisterGroupsErr(router, nil, first, v2, second)
+	if expected := `versioning: path "/api/users" of version "1.0" is registered by more than one group`; err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q but got %v", expected, err)
+	}
+
+	routes, err := versioning.RegisterGroupsErr(router, nil, first, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 {
+		t.Fatalf("expected a single route but got %d", len(routes))
+	}
+
+	expectVersion(t, routes["/api/users"], "1.0").bodyEq("first")
+	expectVersion(t, routes["/api/users"], "2.0").bodyEq(v2Response)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected RegisterGroups to panic")
+		}
+	}()
+	versioning.RegisterGroups(nil, nil, first, second)
+}
+
+// patternMux records the registered patterns, like a Go 1.22+ `http.ServeMux` would receive them.
+type patternMux map[string]http.Handler
+
+func (mux patternMux) Handle(pattern string, handler http.Handler) { mux[pattern] = handler }
+
+func TestRegisterGroupPatterns(t *testing.T) {
+	userAPIV1 := versioning.NewGroup("1.0")
+	userAPIV1.Handle("GET /api/users/{id}", sendHandler("v1 get"))
+
+	userAPIV2 := versioning.NewGroup(">= 2, < 3")
+	userAPIV2.Handle("/api/users/{id}", sendHandler("v2 any"))
+	userAPIV2.Handle("POST /api/users/{id}", sendHandler("v2 post"))
+
+	mux := make(patternMux)
+	routes := versioning.RegisterGroupPatterns(mux, nil, userAPIV1, userAPIV2)
+
+	var patterns []string
+	for pattern := range mux {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	if expected := []string{"/api/users/{id}", "GET /api/users/{id}", "POST /api/users/{id}"}; !reflect.DeepEqual(expected, patterns) {
+		t.Fatalf("expected patterns %v but got %v", expected, patterns)
+	}
+	if len(routes) != len(mux) {
+		t.Fatalf("expected %d routes but got %d", len(mux), len(routes))
+	}
+
+	tests := []struct {
+		pattern string // the one the mux routes the request to.
+		method  string
+		version string
+		status  int
+		body    string
+	}{
+		{"GET /api/users/{id}", http.MethodGet, "1.0", http.StatusOK, "v1 get"},
+		{"GET /api/users/{id}", http.MethodGet, "2.0", http.StatusOK, "v2 any"},
+		{"POST /api/users/{id}", http.MethodPost, "2.0", http.StatusOK, "v2 post"},
+		{"POST /api/users/{id}", http.MethodPost, "1.0", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+		{"/api/users/{id}", http.MethodPut, "2.0", http.StatusOK, "v2 any"},
+		{"/api/users/{id}", http.MethodPut, "1.0", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, "/api/users/42", nil)
+		req.Header.Set(versioning.AcceptVersionHeaderKey, tt.version)
+		mux[tt.pattern].ServeHTTP(w, req)
+
+		(&testie{t: t, resp: w.Result()}).
+			statusCode(tt.status).
+			bodyEq(tt.body)
+	}
+
+	// the methods of the version are allowed, same as the `RegisterGroups`.
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/users/42", nil)
+	req.Header.Set(versioning.AcceptVersionHeaderKey, "1.0")
+	mux["POST /api/users/{id}"].ServeHTTP(w, req)
+	(&testie{t: t, resp: w.Result()}).
+		headerEq("Allow", "GET")
+
+	// same version and method on the same path.
+	conflict := versioning.NewGroup("1.0")
+	conflict.Handle("GET /api/users/{id}", sendHandler("conflict"))
+	if _, err := versioning.RegisterGroupPatternsErr(nil, nil, userAPIV1, conflict); err == nil {
+		t.Fatalf("expected a conflict error")
+	}
+
+	// but a different method is fine.
+	post := versioning.NewGroup("1.0")
+	post.Handle("POST /api/users/{id}", sendHandler("v1 post"))
+	if _, err := versioning.RegisterGroupPatternsErr(nil, nil, userAPIV1, post); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewGroupConcurrent(t *testing.T) {
+	userAPIV1 := versioning.NewGroup("1.0")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			path := fmt.Sprintf("/api/users/%d", i)
+			if i%2 == 0 {
+				userAPIV1.Handle(path, sendHandler(path))
+			} else {
+				userAPIV1.HandleFunc(path, sendHandler(path))
+			}
+
+			if i%10 == 0 {
+				userAPIV1.Deprecated(versioning.DefaultDeprecationOptions)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	routes := versioning.RegisterGroups(nil, nil, userAPIV1)
+	if expected, got := 50, len(routes); expected != got {
+		t.Fatalf("expected %d routes but got %d", expected, got)
+	}
+
+	for path, handler := range routes {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set(versioning.AcceptVersionHeaderKey, "1.0")
+		handler.ServeHTTP(w, r)
+
+		if got := w.Body.String(); path != got {
+			t.Fatalf("%s: expected body: '%s' but got '%s'", path, path, got)
+		}
+	}
+}
+
+func benchmarkMatcher(b *testing.B, options ...versioning.MatcherOption) {
+	versions := make(versioning.Map)
+	for i := 0; i < 20; i++ {
+		versions[fmt.Sprintf(">= %d, < %d", i, i+1)] = sendHandler("")
+	}
+	matcher := versioning.NewMatcher(versions, options...)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "19.5")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matcher.ServeHTTP(w, r)
+	}
+}
+
+// Indicative results, the cache avoids the version parsing and the constraints checks
+// and the major version index limits the checked constraints:
+//
+//	BenchmarkNewMatcher                     1810 ns/op    1360 B/op     16 allocs/op
+//	BenchmarkNewMatcherNoCache (no index)  34327 ns/op   12673 B/op    359 allocs/op
+//	BenchmarkNewMatcherNoCache              5361 ns/op    2816 B/op     51 allocs/op
+func BenchmarkNewMatcher(b *testing.B) {
+	benchmarkMatcher(b)
+}
+
+func BenchmarkNewMatcherNoCache(b *testing.B) {
+	benchmarkMatcher(b, versioning.CacheSize(0))
+}
+
+// Indicative results of the major version index, without the cache:
+//
+//	before: BenchmarkNewMatcherManyVersions  121769 ns/op   50756 B/op   1549 allocs/op
+//	after:  BenchmarkNewMatcherManyVersions    5632 ns/op    3264 B/op     65 allocs/op
+func BenchmarkNewMatcherManyVersions(b *testing.B) {
+	versions := make(versioning.Map)
+	for i := 1; i <= 50; i++ {
+		versions[fmt.Sprintf("%d.0", i)] = sendHandler("")
+		versions[fmt.Sprintf("> %d.0, < %d", i, i+1)] = sendHandler("")
+	}
+	matcher := versioning.NewMatcher(versions, versioning.CacheSize(0))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "9.5")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matcher.ServeHTTP(w, r)
+	}
+}
+
+// Indicative results, the compiled constraint avoids parsing the constraint on each call:
+//
+//	BenchmarkMatch       6059 ns/op    3576 B/op     57 allocs/op
+//	BenchmarkCompiled    2862 ns/op    1440 B/op     34 allocs/op
+func BenchmarkMatch(b *testing.B) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "2.1")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		versioning.Match(r, ">= 2, < 3")
+	}
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(versioning.AcceptVersionHeaderKey, "2.1")
+	constraint := versioning.MustCompile(">= 2, < 3")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		constraint.Matches(r)
+	}
+}
+
 // Small test suite for this package follows.
 
 func expect(t *testing.T, method, url string, testieOptions ...func(*http.Request)) *testie {
@@ -135,6 +2159,20 @@ func expect(t *testing.T, method, url string, testieOptions ...func(*http.Reques
 	return testReq(t, req)
 }
 
+// expectVersion serves the "handler" with the "version" as the "Accept-Version" header,
+// an empty version sends no header at all.
+func expectVersion(t *testing.T, handler http.Handler, version string) *testie {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if version != "" {
+		req.Header.Set(versioning.AcceptVersionHeaderKey, version)
+	}
+	handler.ServeHTTP(w, req)
+	resp := w.Result()
+	resp.Request = req
+	return &testie{t: t, resp: resp}
+}
+
 func withHeader(key string, value string) func(*http.Request) {
 	return func(r *http.Request) {
 		r.Header.Add(key, value)
@@ -240,3 +2278,18 @@ func (te *testie) headerEq(key, expected string) *testie {
 
 	return te
 }
+
+func (te *testie) headerValuesEq(key string, expected ...string) *testie {
+	got := te.resp.Header.Values(key)
+	if len(expected) != len(got) {
+		te.t.Fatalf("%s: expected header values of %s to be: %q but got %q", te.resp.Request.URL, key, expected, got)
+	}
+
+	for i := range expected {
+		if expected[i] != got[i] {
+			te.t.Fatalf("%s: expected header values of %s to be: %q but got %q", te.resp.Request.URL, key, expected, got)
+		}
+	}
+
+	return te
+}
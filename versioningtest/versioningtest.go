@@ -0,0 +1,48 @@
+// Package versioningtest provides utilities for testing the versioned handlers
+// of the github.com/kataras/versioning package.
+package versioningtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/kataras/versioning"
+)
+
+// NewRequest returns a new GET request of the "target" which asks for the "version"
+// through the "Accept-Version" header, see `versioning.AcceptVersionHeaderKey`.
+// An empty "version" sends no version at all.
+func NewRequest(target, version string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if version != "" {
+		key := versioning.AcceptVersionHeaderKey
+		if key == "" { // same as the versioning package does.
+			key = "Accept-Version"
+		}
+
+		r.Header.Set(key, version)
+	}
+
+	return r
+}
+
+// Route serves a request of the "version" to the "handler", i.e a `versioning.NewMatcher`
+// or a route of the `versioning.RegisterGroups`, and returns the recorded response.
+//
+// Example:
+//
+//	w := versioningtest.Route(matcher, "2.1")
+//	if w.Code != http.StatusOK || w.Body.String() != "v2" {
+//		t.Fatalf("unexpected response of version 2.1: %d %q", w.Code, w.Body.String())
+//	}
+func Route(handler http.Handler, version string) *httptest.ResponseRecorder {
+	return ServeRequest(handler, NewRequest("/", version))
+}
+
+// ServeRequest serves the "r" to the "handler" and returns the recorded response,
+// useful for requests of other methods, paths or versioning headers than the `Route`'s ones.
+func ServeRequest(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
@@ -0,0 +1,74 @@
+package versioningtest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/kataras/versioning"
+	"github.com/kataras/versioning/versioningtest"
+)
+
+func sendHandler(contents string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(contents))
+	})
+}
+
+func TestRoute(t *testing.T) {
+	matcher := versioning.NewMatcher(versioning.Map{
+		"1.0":       sendHandler("v1"),
+		">= 2, < 3": sendHandler("v2"),
+	})
+
+	tests := []struct {
+		version    string
+		statusCode int
+		body       string
+	}{
+		{"1.0", http.StatusOK, "v1"},
+		{"2.1", http.StatusOK, "v2"},
+		{"3.0", http.StatusNotImplemented, "version not found"},
+		{"", http.StatusNotImplemented, "version not found"},
+	}
+
+	for _, tt := range tests {
+		w := versioningtest.Route(matcher, tt.version)
+		if w.Code != tt.statusCode {
+			t.Fatalf("[%s] expected status code %d but got %d", tt.version, tt.statusCode, w.Code)
+		}
+
+		if got := w.Body.String(); got != tt.body {
+			t.Fatalf("[%s] expected body %q but got %q", tt.version, tt.body, got)
+		}
+	}
+
+	if got := versioningtest.Route(matcher, "2.1").Header().Get("X-API-Version"); got != "2.1.0" {
+		t.Fatalf("expected the matched version header but got %q", got)
+	}
+}
+
+func TestServeRequest(t *testing.T) {
+	group := versioning.NewGroup("1.0")
+	group.Handle("POST /api/users", sendHandler("v1"))
+	routes := versioning.RegisterGroups(nil, nil, group)
+
+	r := versioningtest.NewRequest("/api/users", "1.0")
+	r.Method = http.MethodPost
+	if w := versioningtest.ServeRequest(routes["/api/users"], r); w.Code != http.StatusOK || w.Body.String() != "v1" {
+		t.Fatalf("expected the v1 handler but got %d %q", w.Code, w.Body.String())
+	}
+
+	if w := versioningtest.Route(routes["/api/users"], "1.0"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status code %d but got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestNewRequestEmptyHeaderKey(t *testing.T) {
+	defer func(key string) { versioning.AcceptVersionHeaderKey = key }(versioning.AcceptVersionHeaderKey)
+	versioning.AcceptVersionHeaderKey = ""
+
+	r := versioningtest.NewRequest("/", "1.0")
+	if got := r.Header.Get("Accept-Version"); got != "1.0" || len(r.Header[""]) > 0 {
+		t.Fatalf("expected the Accept-Version header but got %v", r.Header)
+	}
+}